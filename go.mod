@@ -12,12 +12,14 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
 	github.com/samber/lo v1.50.0
+	github.com/u2takey/ffmpeg-go v0.5.0
+	go.etcd.io/bbolt v1.4.3
 )
 
 require (
 	github.com/aws/aws-sdk-go v1.55.7 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/u2takey/ffmpeg-go v0.5.0 // indirect
 	github.com/u2takey/go-utils v0.3.1 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 )
@@ -21,28 +21,150 @@ type MessageFilter struct {
 	List []int64
 }
 
+// MessageFilterConfig selects which messages reach MaiBot. Forwards applies to messages
+// forwarded into groups, e.g. to drop them in groups that get spammed with forwards.
 type MessageFilterConfig struct {
 	BannedUsers []int64
+	IgnoreEdits bool
 	Groups      MessageFilter
 	Private     MessageFilter
+	Channels    MessageFilter
+	Forwards    MessageFilter
+}
+
+// VoiceConfig controls how inbound voice and video notes are forwarded to MaiBot.
+// Mode is one of "drop" (voice messages without caption are not forwarded at all),
+// "voice" (forward as WAV) or "transcribe" (forward recognized text).
+type VoiceConfig struct {
+	Mode              string
+	TranscribeURL     string
+	TranscribeTimeout int // seconds
+}
+
+// MessageStoreConfig configures where MaiBot <-> Telegram message ID mappings are kept.
+// An empty Path keeps them in memory; otherwise they are persisted to a BoltDB file.
+type MessageStoreConfig struct {
+	Path string
+}
+
+// RateLimitConfig keeps outbound messages within Telegram's flood limits
+type RateLimitConfig struct {
+	GlobalPerSecond  float64
+	GroupPerMinute   float64
+	PrivatePerSecond float64
+	MaxRetries       int
+}
+
+// InboundConfig controls how many chats are converted and forwarded to MaiBot concurrently.
+// Messages of the same chat are always handled in order by one worker.
+// Album items arriving within MediaGroupWindow of each other are merged into one message.
+type InboundConfig struct {
+	Workers          int
+	QueueSize        int
+	MediaGroupWindow int // milliseconds
+}
+
+// TelegramConfig selects how updates are received. Mode is "polling" or "webhook";
+// in webhook mode Telegram posts updates to WebhookURL, which must reach ListenAddr
+// (directly with CertFile/KeyFile, or through a reverse proxy).
+// APIEndpoint and FileEndpoint point to a self-hosted Bot API server (empty means api.telegram.org;
+// an empty FileEndpoint is derived from APIEndpoint);
+// with LocalMode the server runs with --local and files are read from its filesystem.
+// TopicsAsGroups forwards each forum topic as its own MaiBot group "chatID:threadID".
+type TelegramConfig struct {
+	APIEndpoint  string
+	FileEndpoint string
+	LocalMode    bool
+	Mode         string
+	WebhookURL   string
+	ListenAddr   string
+	SecretToken  string
+	CertFile     string
+	KeyFile      string
+
+	TopicsAsGroups bool
+}
+
+// DocumentConfig controls which files are forwarded by content. Files with one of
+// TextExtensions up to MaxTextSize bytes are forwarded as text, images up to MaxImageSize
+// bytes as images, and everything else as a description of the file.
+type DocumentConfig struct {
+	MaxTextSize    int
+	MaxImageSize   int
+	TextExtensions []string
+}
+
+// StickerConfig controls how animated (.tgs) and video (.webm) stickers are forwarded.
+// Format "gif" forwards the whole animation, "frame" only its first frame as PNG.
+// TGSConverter is a command run as `TGSConverter <input.tgs> <output.gif>`; without it, or if it
+// fails, the static thumbnail of animated stickers is forwarded instead.
+type StickerConfig struct {
+	Format       string
+	TGSConverter string
+}
+
+// VideoConfig controls how GIFs, videos and video notes are shown to MaiBot: Frames
+// images spread over the clip, or only Telegram's thumbnail if Frames <= 1 or the
+// clip is larger than MaxSize bytes.
+type VideoConfig struct {
+	Frames  int
+	MaxSize int
 }
 
 type Config struct {
 	Platform         string
 	TelegramBotToken string
+	Telegram         TelegramConfig
 	MaiBot           MaibotConfig
 	MessageFilter    MessageFilterConfig
+	Voice            VoiceConfig
+	MessageStore     MessageStoreConfig
+	RateLimit        RateLimitConfig
+	Inbound          InboundConfig
+	Document         DocumentConfig
+	Sticker          StickerConfig
+	Video            VideoConfig
+	Trigger          TriggerConfig
+}
+
+// TriggerPolicy decides which group messages MaiBot responds to. Mode is "all", "mention"
+// (the bot is @-mentioned or replied to), "keyword" (the text matches one of the Keywords
+// regular expressions) or "probability" (a random Probability share of the messages);
+// mentions and replies always trigger. With ForwardContext the other messages are still
+// forwarded, marked context only, otherwise they are dropped.
+type TriggerPolicy struct {
+	Mode           string
+	Keywords       []string
+	Probability    float64
+	ForwardContext bool
+}
+
+// ChatTriggerPolicy replaces the default TriggerPolicy for one chat
+type ChatTriggerPolicy struct {
+	ChatID int64
+	TriggerPolicy
+}
+
+// TriggerConfig is the default TriggerPolicy of all groups plus per chat overrides
+type TriggerConfig struct {
+	TriggerPolicy
+	Chats []ChatTriggerPolicy
 }
 
 func NewDefaultConfig() *Config {
 	return &Config{
 		Platform:         "telegram",
 		TelegramBotToken: "",
+		Telegram: TelegramConfig{
+			Mode:       "polling",
+			ListenAddr: ":8443",
+		},
 		MaiBot: MaibotConfig{
 			URL: "ws://localhost:8080",
 		},
 		MessageFilter: MessageFilterConfig{
 			BannedUsers: []int64{},
+			IgnoreEdits: false,
 			Groups: MessageFilter{
 				Mode: "whitelist",
 				List: []int64{},
@@ -51,6 +173,57 @@ func NewDefaultConfig() *Config {
 				Mode: "blacklist",
 				List: []int64{},
 			},
+			Channels: MessageFilter{
+				Mode: "whitelist",
+				List: []int64{},
+			},
+			Forwards: MessageFilter{
+				Mode: "blacklist",
+				List: []int64{},
+			},
+		},
+		Voice: VoiceConfig{
+			Mode:              "drop",
+			TranscribeURL:     "",
+			TranscribeTimeout: 30,
+		},
+		MessageStore: MessageStoreConfig{
+			Path: "",
+		},
+		RateLimit: RateLimitConfig{
+			GlobalPerSecond:  30,
+			GroupPerMinute:   20,
+			PrivatePerSecond: 1,
+			MaxRetries:       3,
+		},
+		Inbound: InboundConfig{
+			Workers:          8,
+			QueueSize:        100,
+			MediaGroupWindow: 1000,
+		},
+		Document: DocumentConfig{
+			MaxTextSize:  64 * 1024,
+			MaxImageSize: 10 * 1024 * 1024,
+			TextExtensions: []string{
+				".txt", ".md", ".log", ".csv", ".json", ".yaml", ".yml", ".toml", ".ini", ".xml", ".html",
+				".py", ".go", ".js", ".ts", ".java", ".c", ".cpp", ".h", ".rs", ".sh",
+			},
+		},
+		Sticker: StickerConfig{
+			Format:       "gif",
+			TGSConverter: "",
+		},
+		Video: VideoConfig{
+			Frames:  3,
+			MaxSize: 20 * 1024 * 1024,
+		},
+		Trigger: TriggerConfig{
+			TriggerPolicy: TriggerPolicy{
+				Mode:        "all",
+				Keywords:    []string{},
+				Probability: 1,
+			},
+			Chats: []ChatTriggerPolicy{},
 		},
 	}
 }
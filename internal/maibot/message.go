@@ -107,6 +107,18 @@ func NewReplySegment(messageID string) MessageSegment {
 	}
 }
 
+// NewEchoSegment creates a notify segment telling MaiBot the platform message ID its message was sent as
+func NewEchoSegment(messageID, actualID string) MessageSegment {
+	return MessageSegment{
+		Type: "notify",
+		Data: map[string]interface{}{
+			"sub_type":  "echo",
+			"echo":      messageID,
+			"actual_id": actualID,
+		},
+	}
+}
+
 // NewSegList creates a segment list containing multiple segments
 func NewSegList(segments []MessageSegment) MessageSegment {
 	return MessageSegment{
@@ -2,12 +2,16 @@ package audio
 
 import (
 	"bytes"
+	"encoding/binary"
 	"os"
 
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-// ToOgg converts audio data of any format to OGG format
+// opusSampleRate is the rate Opus granule positions are counted in, regardless of the input rate
+const opusSampleRate = 48000
+
+// ToOgg converts audio data of any format to OGG/Opus format, which Telegram renders as a voice note
 func ToOgg(audioData []byte) ([]byte, error) {
 	// Create input reader from byte slice
 	inputReader := bytes.NewReader(audioData)
@@ -15,9 +19,9 @@ func ToOgg(audioData []byte) ([]byte, error) {
 	// Create output buffer
 	outputBuffer := bytes.NewBuffer(nil)
 
-	// Run ffmpeg conversion to OGG (auto-detect input format)
+	// Run ffmpeg conversion to OGG/Opus (auto-detect input format)
 	err := ffmpeg.Input("pipe:").
-		Output("pipe:", ffmpeg.KwArgs{"f": "ogg", "c:a": "libvorbis"}).
+		Output("pipe:", ffmpeg.KwArgs{"f": "ogg", "c:a": "libopus", "ar": "48000", "ac": "1"}).
 		WithInput(inputReader).
 		WithOutput(outputBuffer, os.Stderr).
 		Run()
@@ -29,18 +33,28 @@ func ToOgg(audioData []byte) ([]byte, error) {
 	return outputBuffer.Bytes(), nil
 }
 
-// ToWav converts audio data of any format to WAV format
+// ToWav converts audio data of any format to WAV format. The input may also be a video,
+// e.g. a video note, in which case its audio track is converted.
 func ToWav(audioData []byte) ([]byte, error) {
-	// Create input reader from byte slice
-	inputReader := bytes.NewReader(audioData)
+	// MP4 files often keep their index at the end, which ffmpeg can't seek to in a pipe
+	file, err := os.CreateTemp("", "audio")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(audioData)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create output buffer
 	outputBuffer := bytes.NewBuffer(nil)
 
 	// Run ffmpeg conversion to WAV (auto-detect input format)
-	err := ffmpeg.Input("pipe:").
+	err = ffmpeg.Input(file.Name()).
 		Output("pipe:", ffmpeg.KwArgs{"f": "wav"}).
-		WithInput(inputReader).
 		WithOutput(outputBuffer, os.Stderr).
 		Run()
 
@@ -50,3 +64,26 @@ func ToWav(audioData []byte) ([]byte, error) {
 
 	return outputBuffer.Bytes(), nil
 }
+
+// OggDuration returns the duration in whole seconds (rounded up) of OGG/Opus data
+func OggDuration(oggData []byte) int {
+	// The granule position of the last page is the total number of samples at 48kHz
+	idx := bytes.LastIndex(oggData, []byte("OggS"))
+	for idx >= 0 && (len(oggData) < idx+14 || oggData[idx+4] != 0) {
+		idx = bytes.LastIndex(oggData[:idx], []byte("OggS"))
+	}
+	if idx < 0 {
+		return 0
+	}
+	samples := int64(binary.LittleEndian.Uint64(oggData[idx+6 : idx+14]))
+
+	// Samples skipped by the decoder at the start of the stream are not part of the duration
+	if head := bytes.Index(oggData, []byte("OpusHead")); head >= 0 && len(oggData) >= head+12 {
+		samples -= int64(binary.LittleEndian.Uint16(oggData[head+10 : head+12]))
+	}
+	if samples <= 0 {
+		return 0
+	}
+
+	return int((samples + opusSampleRate - 1) / opusSampleRate)
+}
@@ -1,13 +1,52 @@
 package image
 
+import (
+	"github.com/cshum/vipsgen/vips"
+)
+
+// stickerSize is the maximum side length Telegram accepts for static stickers
+const stickerSize = 512
+
+// ToWebp converts image data of any format to a WebP sticker fitting within 512x512
 func ToWebp(imageData []byte) ([]byte, error) {
-	// Placeholder for image conversion logic
-	// This function should implement the actual conversion from image format to WebP format
-	return nil, nil // Return nil for both data and error for now
+	// Load image from buffer (auto-detect input format)
+	image, err := vips.NewImageFromBuffer(imageData, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	// Scale so that the longest side is exactly 512 pixels
+	err = image.ThumbnailImage(stickerSize, &vips.ThumbnailImageOptions{Height: stickerSize})
+	if err != nil {
+		return nil, err
+	}
+
+	return image.WebpsaveBuffer(nil)
 }
 
+// FromWebp converts WebP image data to PNG format
 func FromWebp(webpData []byte) ([]byte, error) {
-	// Placeholder for image conversion logic
-	// This function should implement the actual conversion from WebP format to image format
-	return nil, nil // Return nil for both data and error for now
+	// Load WebP image from buffer
+	image, err := vips.NewWebploadBuffer(webpData, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	// Save as PNG to buffer
+	return image.PngsaveBuffer(nil)
+}
+
+// ToPng converts image data of any format to PNG; only the first frame of animations is kept
+func ToPng(imageData []byte) ([]byte, error) {
+	// Load image from buffer (auto-detect input format)
+	image, err := vips.NewImageFromBuffer(imageData, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	// Save as PNG to buffer
+	return image.PngsaveBuffer(nil)
 }
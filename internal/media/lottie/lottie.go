@@ -0,0 +1,37 @@
+package lottie
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ToGif renders an animated sticker (gzipped Lottie, .tgs) to an animated GIF.
+// There is no Lottie renderer for Go, so this runs an external converter invoked
+// as `converter <input.tgs> <output.gif>`, e.g. lottie_convert.py from python-lottie.
+func ToGif(converter string, tgsData []byte) ([]byte, error) {
+	if converter == "" {
+		return nil, errors.New("no TGS converter configured")
+	}
+
+	dir, err := os.MkdirTemp("", "tgs")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "sticker.tgs")
+	output := filepath.Join(dir, "sticker.gif")
+	if err := os.WriteFile(input, tgsData, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(converter, input, output)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(output)
+}
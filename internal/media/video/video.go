@@ -0,0 +1,122 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// gifFilter builds a palette from the clip itself and keeps transparency
+const gifFilter = "split[s0][s1];[s0]palettegen=reserve_transparent=1[p];[s1][p]paletteuse"
+
+// IsWebm reports whether data starts with the EBML header used by WebM/Matroska
+func IsWebm(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3})
+}
+
+// ToGif converts a video clip to an animated GIF
+func ToGif(videoData []byte) ([]byte, error) {
+	return run(videoData, inputArgs(videoData), ffmpeg.KwArgs{"f": "gif", "vf": gifFilter})
+}
+
+// FirstFrame extracts the first frame of a video clip as PNG
+func FirstFrame(videoData []byte) ([]byte, error) {
+	return run(videoData, inputArgs(videoData), ffmpeg.KwArgs{"f": "image2", "c:v": "png", "frames:v": "1"})
+}
+
+// inputArgs picks the libvpx decoder for WebM, since the native VP9 decoder drops the alpha channel
+func inputArgs(videoData []byte) ffmpeg.KwArgs {
+	if IsWebm(videoData) {
+		return ffmpeg.KwArgs{"c:v": "libvpx-vp9"}
+	}
+	return ffmpeg.KwArgs{}
+}
+
+// Frames extracts count frames spread evenly over a clip of the given duration (seconds) as PNG
+func Frames(videoData []byte, duration, count int) ([][]byte, error) {
+	// MP4 files often keep their index at the end, which ffmpeg can't seek to in a pipe
+	file, err := os.CreateTemp("", "video")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(videoData)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	outputBuffer := bytes.NewBuffer(nil)
+	err = ffmpeg.Input(file.Name()).
+		Output("pipe:", ffmpeg.KwArgs{
+			"f":        "image2pipe",
+			"c:v":      "png",
+			"vf":       fmt.Sprintf("fps=%d/%d", count, max(1, duration)),
+			"frames:v": fmt.Sprint(count),
+		}).
+		WithOutput(outputBuffer, os.Stderr).
+		Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return splitPngs(outputBuffer.Bytes())
+}
+
+// splitPngs splits a stream of concatenated PNG images by walking their chunks up to IEND
+func splitPngs(data []byte) ([][]byte, error) {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+
+	var images [][]byte
+	for len(data) > 0 {
+		if !bytes.HasPrefix(data, signature) {
+			return nil, errors.New("invalid PNG stream")
+		}
+
+		end := len(signature)
+		for {
+			if len(data) < end+12 {
+				return nil, errors.New("truncated PNG stream")
+			}
+			length := int(binary.BigEndian.Uint32(data[end : end+4]))
+			chunkType := string(data[end+4 : end+8])
+			end += 12 + length // length, type, data and CRC
+			if chunkType == "IEND" {
+				break
+			}
+		}
+		if end > len(data) {
+			return nil, errors.New("truncated PNG stream")
+		}
+
+		images = append(images, data[:end])
+		data = data[end:]
+	}
+
+	return images, nil
+}
+
+func run(videoData []byte, input, output ffmpeg.KwArgs) ([]byte, error) {
+	// Create input reader from byte slice
+	inputReader := bytes.NewReader(videoData)
+
+	// Create output buffer
+	outputBuffer := bytes.NewBuffer(nil)
+
+	err := ffmpeg.Input("pipe:", input).
+		Output("pipe:", output).
+		WithInput(inputReader).
+		WithOutput(outputBuffer, os.Stderr).
+		Run()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return outputBuffer.Bytes(), nil
+}
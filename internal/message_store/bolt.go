@@ -0,0 +1,87 @@
+package message_store
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	toTelegramBucket = []byte("maibot_to_telegram")
+	toMaiBotBucket   = []byte("telegram_to_maibot")
+)
+
+// BoltStore persists mappings in a BoltDB file so they survive restarts
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the BoltDB file at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(toTelegramBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(toMaiBotBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Save(maibotID string, ref TelegramRef) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		toTelegram := tx.Bucket(toTelegramBucket)
+		if toTelegram.Get([]byte(maibotID)) == nil {
+			if err := toTelegram.Put([]byte(maibotID), []byte(ref.String())); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(toMaiBotBucket).Put([]byte(ref.String()), []byte(maibotID))
+	})
+}
+
+func (s *BoltStore) GetTelegram(maibotID string) (TelegramRef, bool) {
+	var ref TelegramRef
+	var found bool
+
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(toTelegramBucket).Get([]byte(maibotID))
+		if value == nil {
+			return nil
+		}
+		parsed, err := ParseTelegramRef(string(value))
+		if err != nil {
+			return err
+		}
+		ref, found = parsed, true
+		return nil
+	})
+
+	return ref, found
+}
+
+func (s *BoltStore) GetMaiBot(ref TelegramRef) (string, bool) {
+	var id string
+
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		// Copy the value, it is only valid inside the transaction
+		id = string(tx.Bucket(toMaiBotBucket).Get([]byte(ref.String())))
+		return nil
+	})
+
+	return id, id != ""
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
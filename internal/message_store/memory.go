@@ -0,0 +1,70 @@
+package message_store
+
+import (
+	"sync"
+)
+
+// defaultMemoryCapacity bounds the in-memory store so long-running bots don't grow forever
+const defaultMemoryCapacity = 10000
+
+// MemoryStore keeps the most recent mappings in memory, evicting the oldest first
+type MemoryStore struct {
+	mu         sync.RWMutex
+	capacity   int
+	toTelegram map[string]TelegramRef
+	toMaiBot   map[TelegramRef]string
+	order      []TelegramRef
+}
+
+// NewMemoryStore creates an in-memory store holding up to capacity Telegram messages
+func NewMemoryStore(capacity int) *MemoryStore {
+	return &MemoryStore{
+		capacity:   capacity,
+		toTelegram: make(map[string]TelegramRef),
+		toMaiBot:   make(map[TelegramRef]string),
+	}
+}
+
+func (s *MemoryStore) Save(maibotID string, ref TelegramRef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.toTelegram[maibotID]; !ok {
+		s.toTelegram[maibotID] = ref
+	}
+	if _, ok := s.toMaiBot[ref]; !ok {
+		s.order = append(s.order, ref)
+	}
+	s.toMaiBot[ref] = maibotID
+
+	for len(s.order) > s.capacity {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		if id, ok := s.toMaiBot[oldest]; ok && s.toTelegram[id] == oldest {
+			delete(s.toTelegram, id)
+		}
+		delete(s.toMaiBot, oldest)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) GetTelegram(maibotID string) (TelegramRef, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ref, ok := s.toTelegram[maibotID]
+	return ref, ok
+}
+
+func (s *MemoryStore) GetMaiBot(ref TelegramRef) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.toMaiBot[ref]
+	return id, ok
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
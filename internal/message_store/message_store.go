@@ -0,0 +1,56 @@
+package message_store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TelegramRef identifies a Telegram message; message IDs are only unique within a chat
+type TelegramRef struct {
+	ChatID    int64
+	MessageID int
+}
+
+// String encodes the reference as "chatID:messageID"
+func (r TelegramRef) String() string {
+	return strconv.FormatInt(r.ChatID, 10) + ":" + strconv.Itoa(r.MessageID)
+}
+
+// ParseTelegramRef decodes a reference produced by TelegramRef.String
+func ParseTelegramRef(s string) (TelegramRef, error) {
+	chatPart, messagePart, found := strings.Cut(s, ":")
+	if !found {
+		return TelegramRef{}, fmt.Errorf("invalid telegram message reference: %s", s)
+	}
+
+	chatID, err := strconv.ParseInt(chatPart, 10, 64)
+	if err != nil {
+		return TelegramRef{}, fmt.Errorf("invalid telegram chat ID: %w", err)
+	}
+
+	messageID, err := strconv.Atoi(messagePart)
+	if err != nil {
+		return TelegramRef{}, fmt.Errorf("invalid telegram message ID: %w", err)
+	}
+
+	return TelegramRef{ChatID: chatID, MessageID: messageID}, nil
+}
+
+// Store maps MaiBot message IDs to the Telegram messages they were sent as.
+// A MaiBot message may be sent as several Telegram messages (e.g. photo and sticker);
+// the first one saved is the one MaiBot IDs resolve to, while every part resolves back.
+type Store interface {
+	Save(maibotID string, ref TelegramRef) error
+	GetTelegram(maibotID string) (TelegramRef, bool)
+	GetMaiBot(ref TelegramRef) (string, bool)
+	Close() error
+}
+
+// New creates a BoltDB backed store at path, or an in-memory store if path is empty
+func New(path string) (Store, error) {
+	if path == "" {
+		return NewMemoryStore(defaultMemoryCapacity), nil
+	}
+	return NewBoltStore(path)
+}
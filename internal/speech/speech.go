@@ -0,0 +1,64 @@
+package speech
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Transcriber converts WAV audio to text
+type Transcriber interface {
+	Transcribe(wavData []byte) (string, error)
+}
+
+// HTTPTranscriber posts WAV audio to an HTTP endpoint and reads the recognized text from the response
+type HTTPTranscriber struct {
+	endpoint string
+	client   *http.Client
+}
+
+// transcribeResponse is the JSON body returned by the transcription endpoint
+type transcribeResponse struct {
+	Text string `json:"text"`
+}
+
+// NewHTTPTranscriber creates a transcriber for the given endpoint
+func NewHTTPTranscriber(endpoint string, timeout time.Duration) *HTTPTranscriber {
+	return &HTTPTranscriber{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Transcribe sends the audio as an audio/wav request body and expects {"text": "..."} in return
+func (t *HTTPTranscriber) Transcribe(wavData []byte) (string, error) {
+	if t.endpoint == "" {
+		return "", errors.New("transcribe endpoint not configured")
+	}
+
+	resp, err := t.client.Post(t.endpoint, "audio/wav", bytes.NewReader(wavData))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcribe request failed: %d %s", resp.StatusCode, string(body))
+	}
+
+	var result transcribeResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("invalid transcribe response: %w", err)
+	}
+
+	return result.Text, nil
+}
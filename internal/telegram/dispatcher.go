@@ -0,0 +1,28 @@
+package telegram
+
+// dispatcher runs inbound jobs on a fixed pool of workers. Every chat is always
+// handled by the same worker, so messages of one chat are processed strictly in
+// order while different chats are processed concurrently.
+type dispatcher struct {
+	queues []chan func()
+}
+
+func newDispatcher(workers, queueSize int) *dispatcher {
+	d := &dispatcher{queues: make([]chan func(), max(1, workers))}
+	for i := range d.queues {
+		d.queues[i] = make(chan func(), queueSize)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+func (d *dispatcher) work(queue chan func()) {
+	for job := range queue {
+		job()
+	}
+}
+
+// dispatch queues job behind earlier jobs of the same chat; it blocks while that worker's queue is full
+func (d *dispatcher) dispatch(chatID int64, job func()) {
+	d.queues[uint64(chatID)%uint64(len(d.queues))] <- job
+}
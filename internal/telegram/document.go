@@ -0,0 +1,107 @@
+package telegram
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/image"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// convertDocument converts a file: images become image segments, small text files
+// become text segments, and anything else a placeholder describing the file
+func convertDocument(document *tgbotapi.Document) []maibot.MessageSegment {
+	documentConfig := config.Get().Document
+
+	if strings.HasPrefix(document.MimeType, "image/") && document.FileSize <= documentConfig.MaxImageSize {
+		if segment, ok := convertImageDocument(document); ok {
+			return []maibot.MessageSegment{segment}
+		}
+	}
+
+	extension := strings.ToLower(filepath.Ext(document.FileName))
+	if slices.Contains(documentConfig.TextExtensions, extension) && document.FileSize <= documentConfig.MaxTextSize {
+		if segment, ok := convertTextDocument(document); ok {
+			return []maibot.MessageSegment{segment}
+		}
+	}
+
+	return []maibot.MessageSegment{maibot.NewTextSegment(describeDocument(document))}
+}
+
+// convertImageDocument downloads an image sent as a file. Formats other than PNG, JPEG and GIF
+// (WebP, SVG, HEIC, TIFF, ...) are converted to PNG, so MaiBot only gets formats it can read.
+func convertImageDocument(document *tgbotapi.Document) (maibot.MessageSegment, bool) {
+	fileContent, err := GetFileContent(document.FileID, botInstance)
+	if err != nil {
+		logger.Error("Failed to get image document content: %v", err)
+		return maibot.MessageSegment{}, false
+	}
+
+	switch http.DetectContentType(fileContent) {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		fileContent, err = image.ToPng(fileContent)
+		if err != nil {
+			logger.Error("Failed to convert image document to PNG: %v", err)
+			return maibot.MessageSegment{}, false
+		}
+	}
+
+	return maibot.NewImageSegment(base64.StdEncoding.EncodeToString(fileContent)), true
+}
+
+// convertTextDocument downloads a text file and forwards its content together with the file name
+func convertTextDocument(document *tgbotapi.Document) (maibot.MessageSegment, bool) {
+	fileContent, err := GetFileContent(document.FileID, botInstance)
+	if err != nil {
+		logger.Error("Failed to get text document content: %v", err)
+		return maibot.MessageSegment{}, false
+	}
+
+	if !utf8.Valid(fileContent) {
+		logger.Warning("Text document %s is not valid UTF-8", document.FileName)
+		return maibot.MessageSegment{}, false
+	}
+
+	return maibot.NewTextSegment(fmt.Sprintf("[文件] %s\n%s", document.FileName, fileContent)), true
+}
+
+// describeDocument returns a placeholder with the name, size and MIME type of the file
+func describeDocument(document *tgbotapi.Document) string {
+	name := document.FileName
+	if name == "" {
+		name = "未命名文件"
+	}
+
+	description := fmt.Sprintf("[文件] %s (%s", name, formatFileSize(document.FileSize))
+	if document.MimeType != "" {
+		description += ", " + document.MimeType
+	}
+	return description + ")"
+}
+
+// formatFileSize formats a byte count as a human readable size
+func formatFileSize(size int) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size)
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		value /= unit
+		if value < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/message_store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxExtrasMessages bounds how many messages extrasCache keeps the extra fields of
+const maxExtrasMessages = 10000
+
+// messageExtras holds the fields of a message that tgbotapi v5.5.1 does not decode
+type messageExtras struct {
+	MessageID int `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	MessageThreadID int            `json:"message_thread_id"`
+	IsTopicMessage  bool           `json:"is_topic_message"`
+	Quote           *messageQuote  `json:"quote"`
+	ForwardOrigin   *forwardOrigin `json:"forward_origin"`
+}
+
+// messageQuote is the part of the replied message a reply quotes
+type messageQuote struct {
+	Text     string `json:"text"`
+	IsManual bool   `json:"is_manual"`
+}
+
+// updateExtras holds the messageExtras of each message an update may carry
+type updateExtras struct {
+	Message           *messageExtras `json:"message"`
+	EditedMessage     *messageExtras `json:"edited_message"`
+	ChannelPost       *messageExtras `json:"channel_post"`
+	EditedChannelPost *messageExtras `json:"edited_channel_post"`
+}
+
+// decodeUpdate decodes a raw update and records the fields tgbotapi drops
+func decodeUpdate(data []byte) (tgbotapi.Update, error) {
+	var update tgbotapi.Update
+	if err := json.Unmarshal(data, &update); err != nil {
+		return update, err
+	}
+
+	var extras updateExtras
+	if err := json.Unmarshal(data, &extras); err != nil {
+		return update, err
+	}
+	for _, message := range []*messageExtras{extras.Message, extras.EditedMessage, extras.ChannelPost, extras.EditedChannelPost} {
+		if message != nil {
+			extrasCache.remember(*message)
+		}
+	}
+
+	return update, nil
+}
+
+// messageExtrasCache keeps the messageExtras of recent messages, since handlers only get the tgbotapi.Message
+type messageExtrasCache struct {
+	mu       sync.Mutex
+	messages map[message_store.TelegramRef]messageExtras
+	order    []message_store.TelegramRef
+}
+
+var extrasCache = newMessageExtrasCache()
+
+func newMessageExtrasCache() *messageExtrasCache {
+	return &messageExtrasCache{
+		messages: make(map[message_store.TelegramRef]messageExtras),
+	}
+}
+
+// remember stores the extras of a message; messages without any are not kept
+func (c *messageExtrasCache) remember(extras messageExtras) {
+	if !extras.IsTopicMessage && extras.Quote == nil && extras.ForwardOrigin == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ref := message_store.TelegramRef{ChatID: extras.Chat.ID, MessageID: extras.MessageID}
+	if _, ok := c.messages[ref]; !ok {
+		c.order = append(c.order, ref)
+	}
+	c.messages[ref] = extras
+
+	for len(c.order) > maxExtrasMessages {
+		delete(c.messages, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// get returns the extras of a message
+func (c *messageExtrasCache) get(ref message_store.TelegramRef) (messageExtras, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	extras, ok := c.messages[ref]
+	return extras, ok
+}
@@ -3,17 +3,49 @@ package telegram
 import (
 	"errors"
 	"fmt"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"io"
 	"net/http"
+	"os"
+	"strings"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// getFileEndpoint returns the file download endpoint matching the configured API endpoint.
+// File paths are only valid on the server that issued them, so a self-hosted APIEndpoint
+// without FileEndpoint uses the same server's file endpoint.
+func getFileEndpoint(cfg config.TelegramConfig) (string, error) {
+	switch {
+	case cfg.FileEndpoint != "":
+		return cfg.FileEndpoint, nil
+	case cfg.APIEndpoint == "" || cfg.APIEndpoint == tgbotapi.APIEndpoint:
+		return tgbotapi.FileEndpoint, nil
+	case strings.Contains(cfg.APIEndpoint, "/bot%s/%s"):
+		return strings.Replace(cfg.APIEndpoint, "/bot%s/%s", "/file/bot%s/%s", 1), nil
+	default:
+		return "", fmt.Errorf("cannot derive FileEndpoint from APIEndpoint %q, please set it", cfg.APIEndpoint)
+	}
+}
+
 func GetFileContent(fileID string, bot *tgbotapi.BotAPI) ([]byte, error) {
-	url, err := bot.GetFileDirectURL(fileID)
+	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
 	if err != nil {
 		return nil, err
 	}
 
+	// A Bot API server started with --local returns absolute paths on its own filesystem
+	telegramConfig := config.Get().Telegram
+	if telegramConfig.LocalMode {
+		return os.ReadFile(file.FilePath)
+	}
+
+	fileEndpoint, err := getFileEndpoint(telegramConfig)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf(fileEndpoint, bot.Token, file.FilePath)
+
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
@@ -30,3 +62,24 @@ func GetFileContent(fileID string, bot *tgbotapi.BotAPI) ([]byte, error) {
 	}
 	return content, nil
 }
+
+// remoteFile downloads a Telegram file on first use, so several conversions of one file share the download
+type remoteFile struct {
+	fileID  string
+	content []byte
+	err     error
+	fetched bool
+}
+
+func newRemoteFile(fileID string) *remoteFile {
+	return &remoteFile{fileID: fileID}
+}
+
+// get returns the content of the file, downloading it the first time
+func (f *remoteFile) get() ([]byte, error) {
+	if !f.fetched {
+		f.content, f.err = GetFileContent(f.fileID, botInstance)
+		f.fetched = true
+	}
+	return f.content, f.err
+}
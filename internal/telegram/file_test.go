@@ -0,0 +1,43 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestGetFileEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.TelegramConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "official", want: tgbotapi.FileEndpoint},
+		{name: "explicit official", cfg: config.TelegramConfig{APIEndpoint: tgbotapi.APIEndpoint}, want: tgbotapi.FileEndpoint},
+		{
+			name: "self-hosted",
+			cfg:  config.TelegramConfig{APIEndpoint: "http://localhost:8081/bot%s/%s"},
+			want: "http://localhost:8081/file/bot%s/%s",
+		},
+		{
+			name: "explicit file endpoint",
+			cfg:  config.TelegramConfig{APIEndpoint: "http://localhost:8081/bot%s/%s", FileEndpoint: "http://files/%s/%s"},
+			want: "http://files/%s/%s",
+		},
+		{name: "unknown layout", cfg: config.TelegramConfig{APIEndpoint: "http://localhost:8081/api?token=%s&method=%s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getFileEndpoint(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/message_store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// forwardOrigin is the forward_origin of Bot API 7.0, which replaced the forward_* fields tgbotapi decodes
+type forwardOrigin struct {
+	Type            string         `json:"type"`
+	Date            int            `json:"date"`
+	SenderUser      *tgbotapi.User `json:"sender_user"`
+	SenderUserName  string         `json:"sender_user_name"`
+	SenderChat      *tgbotapi.Chat `json:"sender_chat"`
+	Chat            *tgbotapi.Chat `json:"chat"`
+	MessageID       int            `json:"message_id"`
+	AuthorSignature string         `json:"author_signature"`
+}
+
+// forwardInfo describes where a forwarded message came from; it is passed to MaiBot as AdditionalConfig["forward"]
+type forwardInfo struct {
+	From       *tgbotapi.User `json:"from,omitempty"`
+	FromChat   *tgbotapi.Chat `json:"from_chat,omitempty"`
+	SenderName string         `json:"sender_name,omitempty"`
+	Date       int            `json:"date"`
+	MessageID  int            `json:"message_id,omitempty"`
+	Signature  string         `json:"signature,omitempty"`
+}
+
+// getForwardInfo returns where a message was forwarded from, if it was forwarded at all
+func getForwardInfo(message *tgbotapi.Message) (forwardInfo, bool) {
+	if message.ForwardDate != 0 {
+		return forwardInfo{
+			From:       message.ForwardFrom,
+			FromChat:   message.ForwardFromChat,
+			SenderName: message.ForwardSenderName,
+			Date:       message.ForwardDate,
+			MessageID:  message.ForwardFromMessageID,
+			Signature:  message.ForwardSignature,
+		}, true
+	}
+
+	extras, _ := extrasCache.get(message_store.TelegramRef{ChatID: message.Chat.ID, MessageID: message.MessageID})
+	origin := extras.ForwardOrigin
+	if origin == nil {
+		return forwardInfo{}, false
+	}
+
+	info := forwardInfo{Date: origin.Date, Signature: origin.AuthorSignature}
+	switch origin.Type {
+	case "user":
+		info.From = origin.SenderUser
+	case "hidden_user":
+		info.SenderName = origin.SenderUserName
+	case "chat":
+		info.FromChat = origin.SenderChat
+	case "channel":
+		info.FromChat = origin.Chat
+		info.MessageID = origin.MessageID
+	}
+	return info, true
+}
+
+// isForwarded reports whether a message was forwarded from somewhere else
+func isForwarded(message *tgbotapi.Message) bool {
+	_, ok := getForwardInfo(message)
+	return ok
+}
+
+// convertForward describes the origin of a forwarded message as a text segment
+func convertForward(forward forwardInfo) maibot.MessageSegment {
+	var name string
+	switch {
+	case forward.From != nil:
+		name = forward.From.UserName
+		if name == "" {
+			name = strings.TrimSpace(forward.From.FirstName + " " + forward.From.LastName)
+		}
+	case forward.FromChat != nil:
+		name = forward.FromChat.Title
+		if name == "" {
+			name = forward.FromChat.UserName
+		}
+	default:
+		name = forward.SenderName
+	}
+	if name == "" {
+		name = "未知来源"
+	}
+
+	return maibot.NewTextSegment(fmt.Sprintf("[转发自 %s]", name))
+}
@@ -2,13 +2,20 @@ package telegram
 
 import (
 	"encoding/base64"
+	"errors"
 	"github.com/davecgh/go-spew/spew"
 	"io"
+	"maps"
 	"strconv"
+	"strings"
 
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
 	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
 	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
-	"github.com/cshum/vipsgen/vips"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/audio"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/image"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/lottie"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/video"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -16,33 +23,142 @@ func HandleMessage(message tgbotapi.Message) {
 	logger.Info("incoming message")
 	spew.Dump(message)
 
+	trigger := checkTrigger(message)
+	if trigger == triggerDrop {
+		logger.Info("Message did not trigger MaiBot: %s", message.Text)
+		return
+	}
+
 	messageBase := ConvertTelegramToMessageBase(message)
 	if messageBase != nil {
+		addTriggerConfig(messageBase, trigger)
 		SendToMaiBot(messageBase)
 	}
 }
 
 func ConvertTelegramToMessageBase(tgMsg tgbotapi.Message) *maibot.MessageBase {
+	users.rememberMessage(&tgMsg)
+
+	segments, data := convertSegments(tgMsg)
+	messageBase := newMessageBase(tgMsg, segments)
+	addAdditionalConfig(messageBase, data)
+	addAdditionalConfig(messageBase, structuredData(tgMsg))
+
+	if tgMsg.Text != "" {
+		messageBase.RawMessage = tgMsg.Text
+	} else if tgMsg.Caption != "" {
+		messageBase.RawMessage = tgMsg.Caption
+	}
+
+	return messageBase
+}
+
+// HandleEditedMessage forwards the new content of an edited message, marked so MaiBot
+// can replace the original in its context
+func HandleEditedMessage(message tgbotapi.Message) {
+	logger.Info("incoming edited message")
+
+	trigger := checkTrigger(message)
+	if trigger == triggerDrop {
+		logger.Info("Edited message did not trigger MaiBot: %s", message.Text)
+		return
+	}
+
+	messageBase := ConvertTelegramToMessageBase(message)
+	if messageBase != nil {
+		addTriggerConfig(messageBase, trigger)
+		addAdditionalConfig(messageBase, map[string]interface{}{
+			"edited":              true,
+			"edit_date":           message.EditDate,
+			"original_message_id": strconv.Itoa(message.MessageID),
+		})
+		SendToMaiBot(messageBase)
+	}
+}
+
+// HandleMediaGroup forwards all messages of an album as a single MaiBot message
+func HandleMediaGroup(messages []tgbotapi.Message) {
+	logger.Info("incoming media group with %d messages", len(messages))
+
+	trigger := checkTrigger(messages...)
+	if trigger == triggerDrop {
+		logger.Info("Media group did not trigger MaiBot")
+		return
+	}
+
+	messageBase := ConvertMediaGroupToMessageBase(messages)
+	if messageBase != nil {
+		addTriggerConfig(messageBase, trigger)
+		SendToMaiBot(messageBase)
+	}
+}
+
+// ConvertMediaGroupToMessageBase merges the messages of an album into one MessageBase
+// identified by its first message, with all media followed by the caption
+func ConvertMediaGroupToMessageBase(messages []tgbotapi.Message) *maibot.MessageBase {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var segments []maibot.MessageSegment
+	var caption []maibot.MessageSegment
+	var rawMessage string
+	data := make(map[string]interface{})
+
+	for _, tgMsg := range messages {
+		users.rememberMessage(&tgMsg)
+
+		// Telegram shows the caption of an album below all of its items, not below the item carrying it
+		if tgMsg.Caption != "" {
+			caption = append(caption, convertTextWithEntities(tgMsg.Caption, tgMsg.CaptionEntities)...)
+			rawMessage = tgMsg.Caption
+			tgMsg.Caption = ""
+		}
+		itemSegments, itemData := convertSegments(tgMsg)
+		segments = append(segments, itemSegments...)
+		maps.Copy(data, itemData)
+	}
+
+	messageBase := newMessageBase(messages[0], append(segments, caption...))
+	addAdditionalConfig(messageBase, data)
+	messageBase.RawMessage = rawMessage
+	return messageBase
+}
+
+// addAdditionalConfig merges data into the AdditionalConfig of messageBase
+func addAdditionalConfig(messageBase *maibot.MessageBase, data map[string]interface{}) {
+	if len(data) == 0 {
+		return
+	}
+	if messageBase.MessageInfo.AdditionalConfig == nil {
+		messageBase.MessageInfo.AdditionalConfig = make(map[string]interface{})
+	}
+	for key, value := range data {
+		messageBase.MessageInfo.AdditionalConfig[key] = value
+	}
+}
+
+// newMessageBase builds a MessageBase with the sender and chat of tgMsg and the given segments
+func newMessageBase(tgMsg tgbotapi.Message, segments []maibot.MessageSegment) *maibot.MessageBase {
 	platform := "telegram"
 	messageID := strconv.Itoa(tgMsg.MessageID)
-	userID := strconv.FormatInt(tgMsg.From.ID, 10)
 
 	userInfo := &maibot.UserInfo{
 		Platform: platform,
-		UserID:   userID,
 	}
 
-	if tgMsg.From.UserName != "" {
-		userInfo.UserNickname = tgMsg.From.UserName
-	} else if tgMsg.From.FirstName != "" {
-		userInfo.UserNickname = tgMsg.From.FirstName
-		if tgMsg.From.LastName != "" {
-			userInfo.UserNickname += " " + tgMsg.From.LastName
-		}
+	if tgMsg.SenderChat != nil {
+		// Channel posts, anonymous group admins and channel posts in linked discussion groups
+		// are sent on behalf of a chat; From is then nil or a placeholder account
+		userInfo.UserID = strconv.FormatInt(tgMsg.SenderChat.ID, 10)
+	} else if tgMsg.From != nil {
+		userInfo.UserID = strconv.FormatInt(tgMsg.From.ID, 10)
 	}
+	userInfo.UserNickname = senderNickname(&tgMsg)
 
+	// Channels are forwarded like groups, marked with their chat type in AdditionalConfig
 	var groupInfo *maibot.GroupInfo
-	if tgMsg.Chat.IsGroup() || tgMsg.Chat.IsSuperGroup() {
+	if tgMsg.Chat.IsGroup() || tgMsg.Chat.IsSuperGroup() || tgMsg.Chat.IsChannel() {
 		groupInfo = &maibot.GroupInfo{
 			Platform: platform,
 			GroupID:  strconv.FormatInt(tgMsg.Chat.ID, 10),
@@ -52,15 +168,79 @@ func ConvertTelegramToMessageBase(tgMsg tgbotapi.Message) *maibot.MessageBase {
 		}
 	}
 
-	var segments []maibot.MessageSegment
+	// Messages in forum topics carry their topic, optionally as part of the group identity
+	threadID := messageThread(&tgMsg)
+	if groupInfo != nil && threadID != 0 && config.Get().Telegram.TopicsAsGroups {
+		groupInfo.GroupID = topicGroupID(tgMsg.Chat.ID, threadID)
+	}
 
-	if tgMsg.ReplyToMessage != nil {
-		replyID := strconv.Itoa(tgMsg.ReplyToMessage.MessageID)
-		segments = append(segments, maibot.NewReplySegment(replyID))
+	if len(segments) == 0 {
+		segments = append(segments, maibot.NewTextSegment("[未支持的消息类型]"))
 	}
 
+	// Forwarded messages are marked so MaiBot doesn't take them for the sender's own words
+	forward, forwarded := getForwardInfo(&tgMsg)
+	if forwarded {
+		segments = append([]maibot.MessageSegment{convertForward(forward)}, segments...)
+	}
+
+	messageInfo := maibot.MessageInfo{
+		Platform:  platform,
+		MessageID: messageID,
+		Time:      float64(tgMsg.Date),
+		UserInfo:  userInfo,
+		GroupInfo: groupInfo,
+	}
+
+	messageBase := &maibot.MessageBase{
+		MessageInfo:    messageInfo,
+		MessageSegment: maibot.NewSegList(segments),
+	}
+
+	if tgMsg.Chat.IsChannel() {
+		addAdditionalConfig(messageBase, map[string]interface{}{"chat_type": "channel"})
+	}
+	if tgMsg.SenderChat != nil {
+		addAdditionalConfig(messageBase, map[string]interface{}{"sender_chat": tgMsg.SenderChat})
+	}
+	if threadID != 0 {
+		addAdditionalConfig(messageBase, map[string]interface{}{"message_thread_id": threadID})
+	}
+	if forwarded {
+		addAdditionalConfig(messageBase, map[string]interface{}{"forward": forward})
+	}
+
+	return messageBase
+}
+
+// senderNickname returns the name of the user or chat a message was sent by
+func senderNickname(tgMsg *tgbotapi.Message) string {
+	if tgMsg.SenderChat != nil {
+		if tgMsg.SenderChat.Title != "" {
+			return tgMsg.SenderChat.Title
+		}
+		return tgMsg.SenderChat.UserName
+	}
+
+	if tgMsg.From == nil {
+		return ""
+	}
+	if tgMsg.From.UserName != "" {
+		return tgMsg.From.UserName
+	}
+	return strings.TrimSpace(tgMsg.From.FirstName + " " + tgMsg.From.LastName)
+}
+
+// convertSegments converts the content of a Telegram message to MaiBot segments, together with
+// what MaiBot should know about the conversion, for MessageInfo.AdditionalConfig
+func convertSegments(tgMsg tgbotapi.Message) ([]maibot.MessageSegment, map[string]interface{}) {
+	var segments []maibot.MessageSegment
+	data := make(map[string]interface{})
+
+	segments = append(segments, convertReply(tgMsg)...)
+
 	if tgMsg.Text != "" {
-		segments = append(segments, maibot.NewTextSegment(tgMsg.Text))
+		segments = append(segments, convertTextWithEntities(tgMsg.Text, tgMsg.Entities)...)
 	}
 
 	if tgMsg.Photo != nil && len(tgMsg.Photo) > 0 {
@@ -75,58 +255,74 @@ func ConvertTelegramToMessageBase(tgMsg tgbotapi.Message) *maibot.MessageBase {
 		}
 	}
 
-	// temporary disabled 'cuz maibot does not support receive voice yet
-	//if tgMsg.Voice != nil {
-	//	fileContent, err := GetFileContent(tgMsg.Voice.FileID, botInstance)
-	//	if err != nil {
-	//		logger.Error("Failed to get voice content: %v", err)
-	//		segments = append(segments, maibot.NewTextSegment("[语音]"))
-	//	} else {
-	//		wavData, err := audio.ToWav(fileContent)
-	//		if err != nil {
-	//			logger.Error("Failed to convert voice to WAV: %v", err)
-	//			segments = append(segments, maibot.NewTextSegment("[语音]"))
-	//		} else {
-	//			base64Data := base64.StdEncoding.EncodeToString(wavData)
-	//			segments = append(segments, maibot.NewVoiceSegment(base64Data))
-	//		}
-	//	}
-	//}
+	if tgMsg.Voice != nil {
+		voiceSegments, transcribed := convertVoice(newRemoteFile(tgMsg.Voice.FileID))
+		segments = append(segments, voiceSegments...)
+		if transcribed {
+			data["transcribed"] = true
+		}
+	}
+
+	if tgMsg.Animation != nil {
+		segments = append(segments, convertVideo(videoClip{
+			kind:      "动图",
+			file:      newRemoteFile(tgMsg.Animation.FileID),
+			duration:  tgMsg.Animation.Duration,
+			fileSize:  tgMsg.Animation.FileSize,
+			thumbnail: tgMsg.Animation.Thumbnail,
+		})...)
+	}
+
+	if tgMsg.Video != nil {
+		segments = append(segments, convertVideo(videoClip{
+			kind:      "视频",
+			file:      newRemoteFile(tgMsg.Video.FileID),
+			duration:  tgMsg.Video.Duration,
+			fileSize:  tgMsg.Video.FileSize,
+			thumbnail: tgMsg.Video.Thumbnail,
+		})...)
+	}
+
+	if tgMsg.VideoNote != nil {
+		// Frames and sound come from the same download
+		file := newRemoteFile(tgMsg.VideoNote.FileID)
+		segments = append(segments, convertVideo(videoClip{
+			kind:      "视频消息",
+			file:      file,
+			duration:  tgMsg.VideoNote.Duration,
+			fileSize:  tgMsg.VideoNote.FileSize,
+			thumbnail: tgMsg.VideoNote.Thumbnail,
+		})...)
+		voiceSegments, transcribed := convertVoice(file)
+		segments = append(segments, voiceSegments...)
+		if transcribed {
+			data["transcribed"] = true
+		}
+	}
 
 	if tgMsg.Sticker != nil {
-		base64Data, err := convertStickerToBase64PNG(tgMsg.Sticker.FileID)
+		base64Data, err := convertStickerToBase64(tgMsg.Sticker)
 		if err != nil {
-			logger.Error("Failed to convert sticker to PNG: %v", err)
-			segments = append(segments, maibot.NewTextSegment("[贴纸]"))
+			logger.Error("Failed to convert sticker: %v", err)
+			segments = append(segments, maibot.NewTextSegment(strings.TrimSpace("[贴纸] "+tgMsg.Sticker.Emoji)))
 		} else {
 			segments = append(segments, maibot.NewEmojiSegment(base64Data))
 		}
 	}
 
-	if len(segments) == 0 {
-		segments = append(segments, maibot.NewTextSegment("[未支持的消息类型]"))
+	// Animations also carry a Document for older clients
+	if tgMsg.Document != nil && tgMsg.Animation == nil {
+		segments = append(segments, convertDocument(tgMsg.Document)...)
 	}
 
-	messageInfo := maibot.MessageInfo{
-		Platform:  platform,
-		MessageID: messageID,
-		Time:      float64(tgMsg.Date),
-		UserInfo:  userInfo,
-		GroupInfo: groupInfo,
-	}
+	segments = append(segments, convertStructured(tgMsg)...)
 
-	messageBase := &maibot.MessageBase{
-		MessageInfo:    messageInfo,
-		MessageSegment: maibot.NewSegList(segments),
+	// Telegram shows captions below the media they belong to
+	if tgMsg.Caption != "" {
+		segments = append(segments, convertTextWithEntities(tgMsg.Caption, tgMsg.CaptionEntities)...)
 	}
 
-	if tgMsg.Text != "" {
-		messageBase.RawMessage = tgMsg.Text
-	} else if tgMsg.Caption != "" {
-		messageBase.RawMessage = tgMsg.Caption
-	}
-
-	return messageBase
+	return segments, data
 }
 
 func SendToMaiBot(messageBase *maibot.MessageBase) {
@@ -145,35 +341,108 @@ func SendToMaiBot(messageBase *maibot.MessageBase) {
 	logger.Info("Message sent to MaiBot successfully")
 }
 
-// convertStickerToBase64PNG downloads a Telegram sticker (WebP) and converts it to base64-encoded PNG
-func convertStickerToBase64PNG(fileID string) (string, error) {
+// convertStickerToBase64 downloads a Telegram sticker and converts it to base64-encoded
+// PNG (static stickers) or GIF (animated and video stickers, unless only the first frame is wanted)
+func convertStickerToBase64(sticker *tgbotapi.Sticker) (string, error) {
 	// Get bot instance from the global variable in telegram.go
 	if botInstance == nil {
 		return "", io.EOF // Use a standard error; we'll log the details in the caller
 	}
 
-	webpData, err := GetFileContent(fileID, botInstance)
+	fileContent, err := GetFileContent(sticker.FileID, botInstance)
 	if err != nil {
 		return "", err
 	}
 
-	// Initialize vips
-	vips.Startup(nil)
-	defer vips.Shutdown()
+	stickerConfig := config.Get().Sticker
+	frameOnly := stickerConfig.Format == "frame"
 
-	// Load WebP image from buffer
-	image, err := vips.NewWebploadBuffer(webpData, nil)
+	var imageData []byte
+	switch {
+	case sticker.IsAnimated:
+		// Animated stickers are gzipped Lottie (.tgs)
+		imageData, err = lottie.ToGif(stickerConfig.TGSConverter, fileContent)
+		if err == nil && frameOnly {
+			imageData, err = image.ToPng(imageData)
+		}
+		if err != nil {
+			// Without a working converter, Telegram's static thumbnail stands in for the first frame
+			logger.Warning("Failed to convert animated sticker, using its thumbnail: %v", err)
+			imageData, err = stickerThumbnail(sticker)
+		}
+	case video.IsWebm(fileContent):
+		// Video stickers are WebM; tgbotapi v5.5.1 has no IsVideo flag, so check the content
+		if frameOnly {
+			imageData, err = video.FirstFrame(fileContent)
+		} else {
+			imageData, err = video.ToGif(fileContent)
+		}
+	default:
+		imageData, err = image.FromWebp(fileContent)
+	}
 	if err != nil {
 		return "", err
 	}
-	defer image.Close()
 
-	// Save as PNG to buffer
-	pngData, err := image.PngsaveBuffer(nil)
+	// Encode to base64
+	return base64.StdEncoding.EncodeToString(imageData), nil
+}
+
+// stickerThumbnail returns the static thumbnail Telegram provides for a sticker as PNG
+func stickerThumbnail(sticker *tgbotapi.Sticker) ([]byte, error) {
+	if sticker.Thumbnail == nil {
+		return nil, errors.New("sticker has no thumbnail")
+	}
+
+	thumbnail, err := GetFileContent(sticker.Thumbnail.FileID, botInstance)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return image.ToPng(thumbnail)
+}
 
-	// Encode to base64
-	return base64.StdEncoding.EncodeToString(pngData), nil
+// voiceDropped reports whether the voice mode drops voice content; unknown modes count as "drop"
+func voiceDropped() bool {
+	mode := config.Get().Voice.Mode
+	return mode != "voice" && mode != "transcribe"
+}
+
+// convertVoice downloads a voice or video note and converts it according to the configured voice mode.
+// It reports whether the segments hold transcribed text rather than what the user wrote.
+func convertVoice(file *remoteFile) ([]maibot.MessageSegment, bool) {
+	if voiceDropped() {
+		return nil, false
+	}
+
+	fileContent, err := file.get()
+	if err != nil {
+		logger.Error("Failed to get voice content: %v", err)
+		return []maibot.MessageSegment{maibot.NewTextSegment("[语音]")}, false
+	}
+
+	wavData, err := audio.ToWav(fileContent)
+	if err != nil {
+		logger.Error("Failed to convert voice to WAV: %v", err)
+		return []maibot.MessageSegment{maibot.NewTextSegment("[语音]")}, false
+	}
+
+	return convertWav(config.Get().Voice.Mode, wavData)
+}
+
+// convertWav forwards WAV audio as a voice segment in "voice" mode or as transcribed text in "transcribe" mode
+func convertWav(mode string, wavData []byte) ([]maibot.MessageSegment, bool) {
+	switch mode {
+	case "voice":
+		base64Data := base64.StdEncoding.EncodeToString(wavData)
+		return []maibot.MessageSegment{maibot.NewVoiceSegment(base64Data)}, false
+	case "transcribe":
+		text, err := transcriber.Transcribe(wavData)
+		if err != nil {
+			logger.Error("Failed to transcribe voice: %v", err)
+			return []maibot.MessageSegment{maibot.NewTextSegment("[语音]")}, false
+		}
+		return []maibot.MessageSegment{maibot.NewTextSegment("[语音转文字] " + text)}, true
+	default:
+		return nil, false
+	}
 }
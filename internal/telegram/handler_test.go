@@ -0,0 +1,72 @@
+package telegram
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+)
+
+// stubTranscriber returns a fixed result instead of calling a speech-to-text service
+type stubTranscriber struct {
+	text string
+	err  error
+}
+
+func (s stubTranscriber) Transcribe(wavData []byte) (string, error) {
+	return s.text, s.err
+}
+
+func TestConvertWav(t *testing.T) {
+	wavData := []byte("RIFF....WAVE")
+
+	tests := []struct {
+		name            string
+		mode            string
+		transcriber     stubTranscriber
+		want            []maibot.MessageSegment
+		wantTranscribed bool
+	}{
+		{
+			name: "voice",
+			mode: "voice",
+			want: []maibot.MessageSegment{maibot.NewVoiceSegment(base64.StdEncoding.EncodeToString(wavData))},
+		},
+		{
+			name:            "transcribe",
+			mode:            "transcribe",
+			transcriber:     stubTranscriber{text: "你好"},
+			want:            []maibot.MessageSegment{maibot.NewTextSegment("[语音转文字] 你好")},
+			wantTranscribed: true,
+		},
+		{
+			name:        "transcription fails",
+			mode:        "transcribe",
+			transcriber: stubTranscriber{err: errors.New("service unavailable")},
+			want:        []maibot.MessageSegment{maibot.NewTextSegment("[语音]")},
+		},
+		{name: "drop", mode: "drop"},
+		{name: "unknown mode", mode: "whatever"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTranscriber(tt.transcriber)
+			defer SetTranscriber(nil)
+
+			segments, transcribed := convertWav(tt.mode, wavData)
+			if transcribed != tt.wantTranscribed {
+				t.Errorf("transcribed = %v, want %v", transcribed, tt.wantTranscribed)
+			}
+			if len(segments) != len(tt.want) {
+				t.Fatalf("got segments %+v, want %+v", segments, tt.want)
+			}
+			for i := range segments {
+				if segments[i] != tt.want[i] {
+					t.Errorf("segment %d = %+v, want %+v", i, segments[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
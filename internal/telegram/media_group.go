@@ -0,0 +1,74 @@
+package telegram
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pendingMediaGroup collects the messages of one album until no new item arrived for a while
+type pendingMediaGroup struct {
+	messages []tgbotapi.Message
+	timer    *time.Timer
+	done     chan struct{}
+}
+
+// wait blocks until the album is complete and returns its messages in Telegram order
+func (g *pendingMediaGroup) wait() []tgbotapi.Message {
+	<-g.done
+	return g.messages
+}
+
+// mediaGroupBuffer groups album messages, which Telegram delivers as separate
+// updates sharing a MediaGroupID
+type mediaGroupBuffer struct {
+	mu     sync.Mutex
+	groups map[string]*pendingMediaGroup
+	window time.Duration
+}
+
+func newMediaGroupBuffer(window time.Duration) *mediaGroupBuffer {
+	return &mediaGroupBuffer{
+		groups: make(map[string]*pendingMediaGroup),
+		window: window,
+	}
+}
+
+// add buffers an album message. It returns the album and whether this was its first message;
+// the album is complete once window has passed since its last message.
+func (b *mediaGroupBuffer) add(message tgbotapi.Message) (*pendingMediaGroup, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group, ok := b.groups[message.MediaGroupID]
+	if ok {
+		group.messages = append(group.messages, message)
+		group.timer.Reset(b.window)
+		return group, false
+	}
+
+	group = &pendingMediaGroup{
+		messages: []tgbotapi.Message{message},
+		done:     make(chan struct{}),
+	}
+	group.timer = time.AfterFunc(b.window, func() {
+		b.mu.Lock()
+		// A Reset racing with the previous expiry may fire the timer once more
+		if b.groups[message.MediaGroupID] != group {
+			b.mu.Unlock()
+			return
+		}
+		delete(b.groups, message.MediaGroupID)
+		b.mu.Unlock()
+
+		sort.Slice(group.messages, func(i, j int) bool {
+			return group.messages[i].MessageID < group.messages[j].MessageID
+		})
+		close(group.done)
+	})
+	b.groups[message.MediaGroupID] = group
+
+	return group, true
+}
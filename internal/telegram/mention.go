@@ -0,0 +1,59 @@
+package telegram
+
+import (
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// convertTextWithEntities splits text into text and "at" segments according to
+// its mention and text_mention entities, keeping the original order
+func convertTextWithEntities(text string, entities []tgbotapi.MessageEntity) []maibot.MessageSegment {
+	var segments []maibot.MessageSegment
+
+	// Entity offsets and lengths are counted in UTF-16 code units
+	encoded := utf16.Encode([]rune(text))
+	cursor := 0
+
+	appendText := func(end int) {
+		if end > cursor {
+			segments = append(segments, maibot.NewTextSegment(string(utf16.Decode(encoded[cursor:end]))))
+		}
+	}
+
+	for _, entity := range entities {
+		if entity.Offset < cursor || entity.Offset+entity.Length > len(encoded) {
+			continue
+		}
+
+		var userID int64
+		switch {
+		case entity.Type == "text_mention" && entity.User != nil:
+			userID = entity.User.ID
+		case entity.Type == "mention":
+			mention := string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+			id, ok := users.lookupUsername(mention)
+			if !ok {
+				// Unknown usernames stay in the surrounding text
+				continue
+			}
+			userID = id
+		default:
+			continue
+		}
+
+		appendText(entity.Offset)
+		segments = append(segments, maibot.NewAtSegment(strconv.FormatInt(userID, 10)))
+		cursor = entity.Offset + entity.Length
+	}
+	appendText(len(encoded))
+
+	return segments
+}
+
+// utf16Len returns the length of s in UTF-16 code units, the unit Telegram entities are measured in
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -17,13 +17,35 @@ func chatIDFilter(filter config.MessageFilter, id int64) bool {
 }
 
 func MessageFilter(message tgbotapi.Message) bool {
+	// Channel posts and anonymous admins have no From; chats they are sent as can be banned too
 	for _, id := range config.Get().MessageFilter.BannedUsers {
-		if message.From.ID == id {
+		if message.From != nil && message.From.ID == id {
+			return false
+		}
+		if message.SenderChat != nil && message.SenderChat.ID == id {
 			return false
 		}
 	}
 
-	isPrivate := message.Chat.IsPrivate()
+	// With voice dropped, a voice message without caption has nothing left to forward
+	if message.Voice != nil && message.Caption == "" && voiceDropped() {
+		return false
+	}
+
 	filters := config.Get().MessageFilter
-	return chatIDFilter(lo.Ternary(isPrivate, filters.Private, filters.Groups), message.Chat.ID)
+	if message.Chat.IsChannel() {
+		return chatIDFilter(filters.Channels, message.Chat.ID)
+	}
+
+	isPrivate := message.Chat.IsPrivate()
+	if !chatIDFilter(lo.Ternary(isPrivate, filters.Private, filters.Groups), message.Chat.ID) {
+		return false
+	}
+
+	// Groups spammed with forwards can drop them. Channel posts copied into their linked
+	// discussion group are forwards too, but they are the channel's own discussion.
+	if !isPrivate && !message.IsAutomaticForward && isForwarded(&message) {
+		return chatIDFilter(filters.Forwards, message.Chat.ID)
+	}
+	return true
 }
@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/message_store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxReplyExcerpt is how many characters of the replied message are passed on to MaiBot
+const maxReplyExcerpt = 100
+
+// convertReply converts the reply of a message to a reply segment followed by a description
+// of the replied message, so MaiBot knows what it is about even if it never saw that message
+func convertReply(tgMsg tgbotapi.Message) []maibot.MessageSegment {
+	reply := tgMsg.ReplyToMessage
+	// Messages in a forum topic that reply to nothing in particular point to the topic's first message
+	if reply == nil || reply.MessageID == messageThread(&tgMsg) {
+		return nil
+	}
+
+	replyID := strconv.Itoa(reply.MessageID)
+	// Replies to the bot's own messages refer to them by MaiBot's message ID
+	ref := message_store.TelegramRef{ChatID: tgMsg.Chat.ID, MessageID: reply.MessageID}
+	if maibotID, ok := messageStore.GetMaiBot(ref); ok {
+		replyID = maibotID
+	}
+
+	// A quote is the part of the replied message the user selected, which says more than the whole message
+	content := describeReplied(reply)
+	self := message_store.TelegramRef{ChatID: tgMsg.Chat.ID, MessageID: tgMsg.MessageID}
+	if extras, ok := extrasCache.get(self); ok && extras.Quote != nil && extras.Quote.Text != "" {
+		content = "「" + excerpt(extras.Quote.Text, maxReplyExcerpt) + "」"
+	}
+
+	sender := senderNickname(reply)
+	if sender == "" {
+		sender = "未知用户"
+	}
+
+	return []maibot.MessageSegment{
+		maibot.NewReplySegment(replyID),
+		maibot.NewTextSegment(fmt.Sprintf("[回复 %s: %s]，说：", sender, content)),
+	}
+}
+
+// describeReplied summarizes a replied message as its media type and an excerpt of its text or caption
+func describeReplied(message *tgbotapi.Message) string {
+	text := excerpt(message.Text+message.Caption, maxReplyExcerpt)
+
+	mediaType := repliedMediaType(message)
+	if mediaType == "" {
+		return text
+	}
+	return strings.TrimSpace("[" + mediaType + "] " + text)
+}
+
+// repliedMediaType names the kind of media a message carries, or returns "" for plain text
+func repliedMediaType(message *tgbotapi.Message) string {
+	switch {
+	case len(message.Photo) > 0:
+		return "图片"
+	case message.Animation != nil:
+		return "动图"
+	case message.Video != nil:
+		return "视频"
+	case message.VideoNote != nil:
+		return "视频消息"
+	case message.Voice != nil:
+		return "语音"
+	case message.Audio != nil:
+		return "音频"
+	case message.Sticker != nil:
+		return strings.TrimSpace("贴纸 " + message.Sticker.Emoji)
+	case message.Document != nil:
+		return "文件 " + message.Document.FileName
+	case message.Venue != nil, message.Location != nil:
+		return "位置"
+	case message.Contact != nil:
+		return "联系人"
+	case message.Dice != nil:
+		return "骰子"
+	case message.Poll != nil:
+		return "投票"
+	}
+	return ""
+}
+
+// excerpt shortens text to at most limit characters, marking the cut with an ellipsis
+func excerpt(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
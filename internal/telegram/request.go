@@ -0,0 +1,98 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sendRequest is a Bot API send call built from raw params, since the send configs of
+// tgbotapi v5.5.1 can't carry newer fields such as message_thread_id
+type sendRequest struct {
+	method string
+	params tgbotapi.Params
+	files  []tgbotapi.RequestFile
+}
+
+// inputMediaPhoto is a photo of a media group as sendMediaGroup expects it
+type inputMediaPhoto struct {
+	Type            string                   `json:"type"`
+	Media           string                   `json:"media"`
+	Caption         string                   `json:"caption,omitempty"`
+	CaptionEntities []tgbotapi.MessageEntity `json:"caption_entities,omitempty"`
+}
+
+// newSendRequest starts a request to the chat and forum topic of out
+func newSendRequest(method string, out *outgoingMessage) *sendRequest {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", out.chatID)
+	params.AddNonZero("message_thread_id", out.threadID)
+	return &sendRequest{method: method, params: params}
+}
+
+// newTextRequest builds a sendMessage request for a chunk of text
+func newTextRequest(out *outgoingMessage, chunk textChunk) *sendRequest {
+	r := newSendRequest("sendMessage", out)
+	r.setText("text", "entities", chunk)
+	return r
+}
+
+// newFileRequest builds a request that uploads data as the given field, e.g. sendPhoto with "photo"
+func newFileRequest(method, field, name string, data []byte, out *outgoingMessage) *sendRequest {
+	r := newSendRequest(method, out)
+	r.files = append(r.files, tgbotapi.RequestFile{Name: field, Data: tgbotapi.FileBytes{Name: name, Bytes: data}})
+	return r
+}
+
+// newMediaGroupRequest builds a sendMediaGroup request for the images, with the caption on the first one
+func newMediaGroupRequest(out *outgoingMessage, images [][]byte, caption textChunk) *sendRequest {
+	r := newSendRequest("sendMediaGroup", out)
+
+	media := make([]inputMediaPhoto, 0, len(images))
+	for i, imageData := range images {
+		file := fmt.Sprintf("file-%d", i)
+		photo := inputMediaPhoto{Type: "photo", Media: "attach://" + file}
+		if i == 0 {
+			photo.Caption = caption.text
+			photo.CaptionEntities = caption.entities
+		}
+		media = append(media, photo)
+		r.files = append(r.files, tgbotapi.RequestFile{
+			Name: file,
+			Data: tgbotapi.FileBytes{Name: fmt.Sprintf("image%d.png", i), Bytes: imageData},
+		})
+	}
+
+	r.params.AddInterface("media", media)
+	return r
+}
+
+// setText sets a text or caption and its entities
+func (r *sendRequest) setText(textKey, entitiesKey string, chunk textChunk) {
+	r.params.AddNonEmpty(textKey, chunk.text)
+	if len(chunk.entities) > 0 {
+		r.params.AddInterface(entitiesKey, chunk.entities)
+	}
+}
+
+// setReplyTo makes the message a reply, if replyToMessageID is set
+func (r *sendRequest) setReplyTo(replyToMessageID int) {
+	r.params.AddNonZero("reply_to_message_id", replyToMessageID)
+}
+
+// do performs the request and decodes its result into result
+func (r *sendRequest) do(result interface{}) error {
+	var resp *tgbotapi.APIResponse
+	var err error
+	if len(r.files) > 0 {
+		resp, err = botInstance.UploadFiles(r.method, r.params, r.files)
+	} else {
+		resp, err = botInstance.MakeRequest(r.method, r.params)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(resp.Result, result)
+}
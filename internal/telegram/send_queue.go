@@ -0,0 +1,211 @@
+package telegram
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatBurst is how many messages a single chat may send back to back before its rate applies
+const chatBurst = 3
+
+// rateLimiter is a token bucket; callers reserve a token and sleep until it is available
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until the next event is allowed
+func (l *rateLimiter) wait() {
+	if l.rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// untilFull returns how long the bucket takes to refill, after which it is as good as a new limiter
+func (l *rateLimiter) untilFull() time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tokens := min(l.burst, l.tokens+time.Since(l.last).Seconds()*l.rate)
+	return time.Duration((l.burst - tokens) / l.rate * float64(time.Second))
+}
+
+// chatQueue runs the jobs of one chat in order and holds that chat's rate limit
+type chatQueue struct {
+	chatID  int64
+	jobs    []func()
+	running bool
+	limiter *rateLimiter
+}
+
+// outbox serializes outbound messages per chat and keeps them within Telegram's rate limits
+type outbox struct {
+	mu     sync.Mutex
+	chats  map[int64]*chatQueue
+	global *rateLimiter
+	cfg    config.RateLimitConfig
+}
+
+func newOutbox(cfg config.RateLimitConfig) *outbox {
+	return &outbox{
+		chats:  make(map[int64]*chatQueue),
+		global: newRateLimiter(cfg.GlobalPerSecond, max(1, int(cfg.GlobalPerSecond))),
+		cfg:    cfg,
+	}
+}
+
+// chat returns the queue of a chat, creating it on first use. Must be called with o.mu held.
+func (o *outbox) chat(chatID int64) *chatQueue {
+	q, ok := o.chats[chatID]
+	if !ok {
+		// Negative chat IDs are groups, which have a much lower limit than private chats
+		rate := o.cfg.PrivatePerSecond
+		if chatID < 0 {
+			rate = o.cfg.GroupPerMinute / 60
+		}
+		q = &chatQueue{chatID: chatID, limiter: newRateLimiter(rate, chatBurst)}
+		o.chats[chatID] = q
+	}
+	return q
+}
+
+// enqueue schedules job to run after all previously enqueued jobs of the same chat
+func (o *outbox) enqueue(chatID int64, job func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	q := o.chat(chatID)
+	q.jobs = append(q.jobs, job)
+	if !q.running {
+		q.running = true
+		go o.run(q)
+	}
+}
+
+// run drains a chat queue; a new worker is started by enqueue once it is empty
+func (o *outbox) run(q *chatQueue) {
+	for {
+		o.mu.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			o.mu.Unlock()
+			// Forget the chat once its limiter has refilled, so idle chats don't pile up
+			time.AfterFunc(q.limiter.untilFull(), func() { o.removeIdle(q) })
+			return
+		}
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		o.mu.Unlock()
+
+		job()
+	}
+}
+
+// removeIdle removes a chat queue unless it got new jobs in the meantime
+func (o *outbox) removeIdle(q *chatQueue) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !q.running && len(q.jobs) == 0 && o.chats[q.chatID] == q {
+		delete(o.chats, q.chatID)
+	}
+}
+
+// send sends a single message through the rate limits and retries of do
+func (o *outbox) send(chatID int64, r *sendRequest) (tgbotapi.Message, error) {
+	var message tgbotapi.Message
+	err := o.do(chatID, 1, func() error {
+		return r.do(&message)
+	})
+	return message, err
+}
+
+// sendMediaGroup sends an album, which counts as one message per item against the rate limits
+func (o *outbox) sendMediaGroup(chatID int64, r *sendRequest) ([]tgbotapi.Message, error) {
+	var messages []tgbotapi.Message
+	err := o.do(chatID, len(r.files), func() error {
+		return r.do(&messages)
+	})
+	return messages, err
+}
+
+// do runs request after waiting for cost slots of the rate limits, honoring retry_after
+// on flood control errors and retrying transient failures with backoff
+func (o *outbox) do(chatID int64, cost int, request func() error) error {
+	o.mu.Lock()
+	limiter := o.chat(chatID).limiter
+	o.mu.Unlock()
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		for i := 0; i < cost; i++ {
+			o.global.wait()
+			limiter.wait()
+		}
+
+		err := request()
+		if err == nil {
+			return nil
+		}
+
+		delay, retry := retryDelay(err, backoff)
+		if !retry || attempt >= o.cfg.MaxRetries {
+			return err
+		}
+
+		logger.Warning("Send to chat %d failed (attempt %d), retrying in %s: %v", chatID, attempt+1, delay, err)
+		time.Sleep(delay)
+		backoff *= 2
+	}
+}
+
+// retryDelay decides whether a failed request should be retried and after how long
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		// Network errors may have happened before Telegram got the request. Anything else,
+		// such as a response that fails to decode, means the message was already sent.
+		var netErr net.Error
+		return backoff, errors.As(err, &netErr)
+	}
+
+	if apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+
+	// Server side errors are worth another try, client errors are not
+	return backoff, apiErr.Code >= 500
+}
@@ -0,0 +1,153 @@
+package telegram
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/samber/lo"
+)
+
+const (
+	// maxMessageLength is the maximum length of a text message, in UTF-16 code units
+	maxMessageLength = 4096
+	// maxCaptionLength is the maximum length of a media caption, in UTF-16 code units
+	maxCaptionLength = 1024
+)
+
+// textChunk is a piece of a longer text together with the entities that fall inside it
+type textChunk struct {
+	text     string
+	entities []tgbotapi.MessageEntity
+}
+
+// splitText splits text into chunks of at most limit UTF-16 code units, preferring
+// paragraph, line, sentence and word boundaries and never cutting through an entity
+func splitText(text string, entities []tgbotapi.MessageEntity, limit int) []textChunk {
+	var chunks []textChunk
+
+	rest := textChunk{text: text, entities: entities}
+	for rest.text != "" {
+		var head textChunk
+		head, rest = splitHead(rest.text, rest.entities, limit)
+		if strings.TrimSpace(head.text) != "" {
+			chunks = append(chunks, head)
+		}
+	}
+
+	return chunks
+}
+
+// splitHead cuts the first chunk of at most limit UTF-16 code units off text and returns it and the remainder
+func splitHead(text string, entities []tgbotapi.MessageEntity, limit int) (textChunk, textChunk) {
+	encoded := utf16.Encode([]rune(text))
+	if len(encoded) <= limit {
+		return textChunk{text: text, entities: entities}, textChunk{}
+	}
+
+	cut := findCut(encoded, entities, limit)
+	return sliceChunk(encoded, entities, 0, cut), sliceChunk(encoded, entities, cut, len(encoded))
+}
+
+// findCut picks where to end the first chunk of encoded, at most limit code units in
+func findCut(encoded []uint16, entities []tgbotapi.MessageEntity, limit int) int {
+	window := string(utf16.Decode(encoded[:limit]))
+
+	// Prefer the latest natural boundary in the second half of the window, so chunks don't get tiny
+	cut := 0
+	for _, separators := range [][]string{
+		{"\n\n"},
+		{"\n"},
+		{"。", "！", "？", "…", ". ", "! ", "? "},
+		{" ", "，", "、", ", "},
+	} {
+		for _, separator := range separators {
+			if idx := strings.LastIndex(window, separator); idx >= 0 {
+				cut = max(cut, utf16Len(window[:idx+len(separator)]))
+			}
+		}
+		if cut > limit/2 {
+			break
+		}
+		cut = 0
+	}
+	if cut == 0 {
+		cut = graphemeBoundary(encoded, limit)
+	}
+
+	// Move the cut in front of any entity it would split; repeat since entities may overlap
+	for moved := true; moved; {
+		moved = false
+		for _, entity := range entities {
+			if entity.Offset > 0 && entity.Offset < cut && cut < entity.Offset+entity.Length {
+				cut = entity.Offset
+				moved = true
+			}
+		}
+	}
+
+	return cut
+}
+
+// graphemeBoundary steps back from pos until it no longer splits a surrogate pair or a grapheme cluster.
+// A single grapheme cluster longer than pos is cut between its runes, but never inside a surrogate pair.
+func graphemeBoundary(encoded []uint16, pos int) int {
+	for cut := pos; cut > 0; cut-- {
+		r := decodeAt(encoded, cut)
+		prev := decodeAt(encoded, previousRune(encoded, cut))
+
+		joinsPrevious := unicode.In(r, unicode.Mn, unicode.Me) ||
+			r == '\u200d' || prev == '\u200d' ||
+			unicode.Is(unicode.Variation_Selector, r) ||
+			(r >= 0x1F3FB && r <= 0x1F3FF) // emoji skin tone modifiers
+		if !splitsSurrogate(encoded, cut) && !joinsPrevious {
+			return cut
+		}
+	}
+
+	if splitsSurrogate(encoded, pos) {
+		// With room for less than one rune, take the whole rune rather than an empty chunk
+		return lo.Ternary(pos > 1, pos-1, pos+1)
+	}
+	return pos
+}
+
+// splitsSurrogate reports whether pos falls between the two halves of a surrogate pair
+func splitsSurrogate(encoded []uint16, pos int) bool {
+	return pos > 0 && pos < len(encoded) && encoded[pos] >= 0xDC00 && encoded[pos] <= 0xDFFF
+}
+
+// previousRune returns the start of the rune ending right before pos
+func previousRune(encoded []uint16, pos int) int {
+	if pos >= 2 && utf16.IsSurrogate(rune(encoded[pos-1])) && encoded[pos-1] >= 0xDC00 {
+		return pos - 2
+	}
+	return pos - 1
+}
+
+// decodeAt decodes the rune starting at pos
+func decodeAt(encoded []uint16, pos int) rune {
+	if pos+1 < len(encoded) && utf16.IsSurrogate(rune(encoded[pos])) {
+		return utf16.DecodeRune(rune(encoded[pos]), rune(encoded[pos+1]))
+	}
+	return rune(encoded[pos])
+}
+
+// sliceChunk returns encoded[from:to] with the overlapping entities clipped and shifted to match
+func sliceChunk(encoded []uint16, entities []tgbotapi.MessageEntity, from, to int) textChunk {
+	chunk := textChunk{text: string(utf16.Decode(encoded[from:to]))}
+
+	for _, entity := range entities {
+		start := max(entity.Offset, from)
+		end := min(entity.Offset+entity.Length, to)
+		if start >= end {
+			continue
+		}
+		entity.Offset = start - from
+		entity.Length = end - start
+		chunk.entities = append(chunk.entities, entity)
+	}
+
+	return chunk
+}
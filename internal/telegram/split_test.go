@@ -0,0 +1,170 @@
+package telegram
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSplitText(t *testing.T) {
+	family := "👨‍👩‍👧‍👦"
+
+	tests := []struct {
+		name     string
+		text     string
+		entities []tgbotapi.MessageEntity
+		limit    int
+		chunks   int // expected number of chunks, 0 to skip the check
+	}{
+		{name: "fits", text: "hello world", limit: 20, chunks: 1},
+		{name: "paragraphs", text: strings.Repeat("a", 30) + "\n\n" + strings.Repeat("b", 30), limit: 40, chunks: 2},
+		{name: "lines", text: strings.Repeat("line of text\n", 20), limit: 50},
+		{name: "sentences", text: strings.Repeat("这是一个句子。", 30), limit: 25},
+		{name: "words", text: strings.Repeat("word ", 100), limit: 33},
+		{name: "no boundary", text: strings.Repeat("x", 100), limit: 30, chunks: 4},
+		{name: "surrogate pairs", text: strings.Repeat("😀", 50), limit: 7},
+		{name: "zwj sequences", text: strings.Repeat(family, 10), limit: 25},
+		{name: "grapheme longer than limit", text: strings.Repeat(family, 3), limit: 4},
+		{name: "combining marks", text: strings.Repeat("é", 40), limit: 9},
+		{name: "skin tones", text: strings.Repeat("👍🏽", 20), limit: 9},
+		{
+			name:     "entity kept whole",
+			text:     strings.Repeat("a", 15) + " " + strings.Repeat("b", 10) + " tail",
+			entities: []tgbotapi.MessageEntity{{Type: "bold", Offset: 16, Length: 10}},
+			limit:    20,
+		},
+		{
+			name:     "entity longer than limit",
+			text:     "start " + strings.Repeat("c", 50) + " end",
+			entities: []tgbotapi.MessageEntity{{Type: "italic", Offset: 6, Length: 50}},
+			limit:    20,
+		},
+		{
+			name: "overlapping entities",
+			text: strings.Repeat("one two three four five six ", 5),
+			entities: []tgbotapi.MessageEntity{
+				{Type: "bold", Offset: 4, Length: 30},
+				{Type: "italic", Offset: 20, Length: 40},
+				{Type: "text_link", Offset: 100, Length: 30, URL: "https://example.com"},
+			},
+			limit: 32,
+		},
+		{
+			name:     "entities after emoji",
+			text:     strings.Repeat("😀 ", 10) + "@someone " + strings.Repeat("😀 ", 10),
+			entities: []tgbotapi.MessageEntity{{Type: "mention", Offset: 30, Length: 8}},
+			limit:    16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitText(tt.text, tt.entities, tt.limit)
+			if tt.chunks != 0 && len(chunks) != tt.chunks {
+				t.Errorf("got %d chunks, want %d", len(chunks), tt.chunks)
+			}
+
+			var joined strings.Builder
+			for i, chunk := range chunks {
+				checkChunk(t, i, chunk, tt.limit)
+				joined.WriteString(chunk.text)
+			}
+
+			if got, want := stripSpace(joined.String()), stripSpace(tt.text); got != want {
+				t.Errorf("content changed:\n got %q\nwant %q", got, want)
+			}
+			if got, want := entityContent(chunks), entityContent([]textChunk{{text: tt.text, entities: tt.entities}}); !maps.Equal(got, want) {
+				t.Errorf("entity content changed:\n got %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSplitTextKeepsFittingEntityWhole(t *testing.T) {
+	text := strings.Repeat("a", 15) + " " + strings.Repeat("b", 10) + " tail"
+	entities := []tgbotapi.MessageEntity{{Type: "bold", Offset: 16, Length: 10}}
+
+	for _, chunk := range splitText(text, entities, 20) {
+		for _, entity := range chunk.entities {
+			if entity.Length != 10 {
+				t.Errorf("entity was split: %+v in %q", entity, chunk.text)
+			}
+		}
+	}
+}
+
+func TestSplitHead(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tgbotapi.MessageEntity
+		limit    int
+		wantRest bool
+	}{
+		{name: "fits", text: "short caption", limit: 1024},
+		{name: "exact", text: strings.Repeat("a", 10), limit: 10},
+		{name: "too long", text: strings.Repeat("caption text. ", 100), limit: 1024, wantRest: true},
+		{
+			name:     "entity across cut",
+			text:     strings.Repeat("x", 8) + strings.Repeat("y", 8),
+			entities: []tgbotapi.MessageEntity{{Type: "code", Offset: 6, Length: 6}},
+			limit:    10,
+			wantRest: true,
+		},
+		{name: "emoji at cut", text: strings.Repeat("😀", 10), limit: 5, wantRest: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head, rest := splitHead(tt.text, tt.entities, tt.limit)
+			checkChunk(t, 0, head, tt.limit)
+			checkChunk(t, 1, rest, len(tt.text))
+
+			if head.text+rest.text != tt.text {
+				t.Errorf("head %q + rest %q != %q", head.text, rest.text, tt.text)
+			}
+			if (rest.text != "") != tt.wantRest {
+				t.Errorf("rest = %q, want rest: %v", rest.text, tt.wantRest)
+			}
+		})
+	}
+}
+
+// checkChunk verifies a chunk fits the limit, contains no broken runes and only entities inside it
+func checkChunk(t *testing.T, i int, chunk textChunk, limit int) {
+	t.Helper()
+
+	length := utf16Len(chunk.text)
+	if length > limit {
+		t.Errorf("chunk %d is %d code units long, limit %d", i, length, limit)
+	}
+	if strings.ContainsRune(chunk.text, unicode.ReplacementChar) {
+		t.Errorf("chunk %d contains a broken rune: %q", i, chunk.text)
+	}
+	for _, entity := range chunk.entities {
+		if entity.Offset < 0 || entity.Length <= 0 || entity.Offset+entity.Length > length {
+			t.Errorf("chunk %d has entity %+v out of range for length %d", i, entity, length)
+		}
+	}
+}
+
+// entityContent returns the text covered by the entities of each type, to compare it before and after splitting
+func entityContent(chunks []textChunk) map[string]string {
+	content := make(map[string]string)
+	for _, chunk := range chunks {
+		encoded := utf16.Encode([]rune(chunk.text))
+		for _, entity := range chunk.entities {
+			covered := string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+			content[entity.Type] += stripSpace(covered)
+		}
+	}
+	return content
+}
+
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,60 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// convertStructured describes locations, venues, contacts, dice and polls as readable text
+func convertStructured(tgMsg tgbotapi.Message) []maibot.MessageSegment {
+	var text string
+
+	switch {
+	case tgMsg.Venue != nil:
+		// Venues carry a Location as well, so they are checked first
+		venue := tgMsg.Venue
+		text = fmt.Sprintf("[位置] %f,%f %s %s", venue.Location.Latitude, venue.Location.Longitude, venue.Title, venue.Address)
+	case tgMsg.Location != nil:
+		text = fmt.Sprintf("[位置] %f,%f", tgMsg.Location.Latitude, tgMsg.Location.Longitude)
+	case tgMsg.Contact != nil:
+		name := strings.TrimSpace(tgMsg.Contact.FirstName + " " + tgMsg.Contact.LastName)
+		text = fmt.Sprintf("[联系人] %s %s", name, tgMsg.Contact.PhoneNumber)
+	case tgMsg.Dice != nil:
+		text = fmt.Sprintf("[骰子] %s %d", tgMsg.Dice.Emoji, tgMsg.Dice.Value)
+	case tgMsg.Poll != nil:
+		options := make([]string, 0, len(tgMsg.Poll.Options))
+		for _, option := range tgMsg.Poll.Options {
+			options = append(options, option.Text)
+		}
+		text = fmt.Sprintf("[投票] %s: %s", tgMsg.Poll.Question, strings.Join(options, " / "))
+	default:
+		return nil
+	}
+
+	return []maibot.MessageSegment{maibot.NewTextSegment(text)}
+}
+
+// structuredData returns the raw Bot API objects behind convertStructured, for MessageInfo.AdditionalConfig
+func structuredData(tgMsg tgbotapi.Message) map[string]interface{} {
+	data := make(map[string]interface{})
+
+	if tgMsg.Venue != nil {
+		data["venue"] = tgMsg.Venue
+	} else if tgMsg.Location != nil {
+		data["location"] = tgMsg.Location
+	}
+	if tgMsg.Contact != nil {
+		data["contact"] = tgMsg.Contact
+	}
+	if tgMsg.Dice != nil {
+		data["dice"] = tgMsg.Dice
+	}
+	if tgMsg.Poll != nil {
+		data["poll"] = tgMsg.Poll
+	}
+
+	return data
+}
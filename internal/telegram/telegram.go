@@ -1,70 +1,168 @@
 package telegram
 
 import (
+	"encoding/base64"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
 	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
 	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/audio"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/image"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/message_store"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/speech"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/samber/lo"
 )
 
 var botInstance *tgbotapi.BotAPI
 
+// transcriber converts inbound voice to text when Voice.Mode is "transcribe"
+var transcriber speech.Transcriber
+
+// messageStore maps MaiBot message IDs to the Telegram messages they were sent as
+var messageStore message_store.Store
+
+// outbound queues messages per chat and keeps them within Telegram's rate limits
+var outbound *outbox
+
+// ready is closed once StartBot has set up botInstance, outbound and messageStore.
+// MaiBot messages arrive on other goroutines, and closing the channel is what makes
+// those assignments visible to them.
+var ready = make(chan struct{})
+
+// SetTranscriber replaces the speech-to-text backend, e.g. with a local stub in tests
+func SetTranscriber(t speech.Transcriber) {
+	transcriber = t
+}
+
 func StartBot() {
-	bot, err := tgbotapi.NewBotAPI(config.Get().TelegramBotToken)
+	apiEndpoint := config.Get().Telegram.APIEndpoint
+	if apiEndpoint == "" {
+		apiEndpoint = tgbotapi.APIEndpoint
+	}
+
+	// Fail now rather than on the first download if files can't be fetched from the server
+	if telegramConfig := config.Get().Telegram; !telegramConfig.LocalMode {
+		if _, err := getFileEndpoint(telegramConfig); err != nil {
+			panic(err)
+		}
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(config.Get().TelegramBotToken, apiEndpoint)
 	if err != nil {
 		panic(err)
 	}
 
-	botInstance = bot
 	bot.Debug = true
 
-	// Create a new UpdateConfig struct with an offset of 0. Offsets are used
-	// to make sure Telegram knows we've handled previous values and we don't
-	// need them repeated.
-	updateConfig := tgbotapi.NewUpdate(0)
+	outbound = newOutbox(config.Get().RateLimit)
+
+	// Opening the store may wait on a locked file while MaiBot is already sending messages;
+	// SendMessageToTelegram refuses them until ready is closed
+	messageStore, err = message_store.New(config.Get().MessageStore.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	botInstance = bot
+	close(ready)
 
-	// Tell Telegram we should wait up to 30 seconds on each request for an
-	// update. This way we can get information just as quickly as making many
-	// frequent requests without having to send nearly as many.
-	updateConfig.Timeout = 30
+	// Let mentions of the bot itself resolve to its user ID
+	users.remember(&bot.Self)
 
-	// Start polling Telegram for updates.
-	updates := bot.GetUpdatesChan(updateConfig)
+	if transcriber == nil {
+		voiceConfig := config.Get().Voice
+		transcriber = speech.NewHTTPTranscriber(voiceConfig.TranscribeURL, time.Duration(voiceConfig.TranscribeTimeout)*time.Second)
+	}
+
+	inboundConfig := config.Get().Inbound
+	inbound := newDispatcher(inboundConfig.Workers, inboundConfig.QueueSize)
+	albums := newMediaGroupBuffer(time.Duration(inboundConfig.MediaGroupWindow) * time.Millisecond)
+
+	var updates tgbotapi.UpdatesChannel
+	if telegramConfig := config.Get().Telegram; telegramConfig.Mode == "webhook" {
+		updates, err = startWebhook(bot, telegramConfig)
+	} else {
+		updates, err = startPolling(bot)
+	}
+	if err != nil {
+		panic(err)
+	}
 
 	// Let's go through each update that we're getting from Telegram.
 	for update := range updates {
 		// Telegram can send many  types of updates depending on what your Bot
-		// is up to. We only want to look at messages for now, so we can
-		// discard any other updates.
-		if update.Message == nil {
+		// is up to. We only want to look at messages and their edits for now,
+		// so we can discard any other updates.
+		// Channel posts are handled like messages; MessageFilter tells them apart by chat type
+		if update.EditedMessage != nil || update.EditedChannelPost != nil {
+			handleEditedMessageUpdate(inbound, *lo.CoalesceOrEmpty(update.EditedMessage, update.EditedChannelPost))
+			continue
+		}
+
+		if update.Message == nil && update.ChannelPost == nil {
+			continue
+		}
+
+		message := *lo.CoalesceOrEmpty(update.Message, update.ChannelPost)
+		if !MessageFilter(message) {
+			logger.Info("Message filtered out: %s", message.Text)
 			continue
 		}
 
-		if !MessageFilter(*update.Message) {
-			logger.Info("Message filtered out: %s", update.Message.Text)
+		// Albums are queued once, at their first item, and handled when all items arrived,
+		// so that later messages of the chat still reach MaiBot after the album
+		if message.MediaGroupID != "" {
+			if group, first := albums.add(message); first {
+				inbound.dispatch(message.Chat.ID, func() { HandleMediaGroup(group.wait()) })
+			}
 			continue
 		}
 
-		go HandleMessage(*update.Message)
+		inbound.dispatch(message.Chat.ID, func() { HandleMessage(message) })
+	}
+}
+
+// handleEditedMessageUpdate queues an edited message unless edits are ignored or it is filtered out
+func handleEditedMessageUpdate(inbound *dispatcher, message tgbotapi.Message) {
+	if config.Get().MessageFilter.IgnoreEdits {
+		return
 	}
+
+	// Live locations are re-sent as edits every few seconds while they are shared
+	if message.Location != nil && message.Location.LivePeriod > 0 {
+		return
+	}
+
+	if !MessageFilter(message) {
+		logger.Info("Edited message filtered out: %s", message.Text)
+		return
+	}
+
+	inbound.dispatch(message.Chat.ID, func() { HandleEditedMessage(message) })
 }
 
 // SendMessageToTelegram sends a MessageBase message to Telegram
 func SendMessageToTelegram(messageBase *maibot.MessageBase) error {
-	if botInstance == nil {
+	select {
+	case <-ready:
+	default:
 		logger.Error("Telegram bot not initialized")
 		return nil
 	}
 
 	// Parse group/chat ID
 	var chatID int64
+	var threadID int
 	var err error
 
 	if messageBase.IsGroupMessage() {
-		chatID, err = strconv.ParseInt(messageBase.GetGroupID(), 10, 64)
+		// Group IDs of forum topics forwarded as separate groups name the topic as well
+		chatID, threadID, err = parseGroupID(messageBase.GetGroupID())
 	} else {
 		// For private messages, we need to use the user ID as chat ID
 		chatID, err = strconv.ParseInt(messageBase.GetSenderID(), 10, 64)
@@ -75,18 +173,41 @@ func SendMessageToTelegram(messageBase *maibot.MessageBase) error {
 		return err
 	}
 
-	// Convert MessageBase to Telegram message using enhanced conversion
-	return convertAndSendMessage(messageBase, chatID)
+	// Convert MessageBase to Telegram message using enhanced conversion; messages to the
+	// same chat are sent one after another so a slow upload can't be overtaken
+	outbound.enqueue(chatID, func() {
+		if err := convertAndSendMessage(messageBase, chatID, threadID); err != nil {
+			logger.Error("Failed to send message to chat %d: %v", chatID, err)
+		}
+	})
+	return nil
+}
+
+// maxMediaGroupSize is the maximum number of items Telegram accepts in one album
+const maxMediaGroupSize = 10
+
+// outgoingMessage collects the content of a MaiBot message before it is sent to Telegram
+type outgoingMessage struct {
+	chatID           int64
+	threadID         int
+	text             strings.Builder
+	entities         []tgbotapi.MessageEntity
+	replyToMessageID int
+	images           [][]byte
+	stickers         [][]byte
+	voices           [][]byte
+	sent             []tgbotapi.Message
 }
 
 // convertAndSendMessage converts MessageBase segments to Telegram message format and sends it
-func convertAndSendMessage(messageBase *maibot.MessageBase, chatID int64) error {
-	var replyToMessageID int
-	var messageText strings.Builder
+func convertAndSendMessage(messageBase *maibot.MessageBase, chatID int64, threadID int) error {
+	out := &outgoingMessage{chatID: chatID, threadID: threadID}
+	// Record whatever was sent, even if a later part of the message fails
+	defer func() { recordSentMessages(messageBase, out.threadID, out.sent) }()
 
 	// Handle single segment (like the example message)
 	if messageBase.MessageSegment.Type != "seglist" {
-		processSegment(messageBase.MessageSegment, &messageText, &replyToMessageID)
+		processSegment(messageBase.MessageSegment, out)
 	} else {
 		// Handle seglist
 		segments, err := messageBase.GetSegments()
@@ -96,54 +217,341 @@ func convertAndSendMessage(messageBase *maibot.MessageBase, chatID int64) error
 		}
 
 		for _, segment := range segments {
-			processSegment(segment, &messageText, &replyToMessageID)
+			processSegment(segment, out)
 		}
 	}
 
-	// Handle empty message text
-	if messageText.Len() == 0 {
-		messageText.WriteString("[空消息]")
+	if out.threadID == 0 {
+		out.threadID = resolveThreadID(messageBase, out)
 	}
 
-	// Create and send message
-	msg := tgbotapi.NewMessage(chatID, messageText.String())
-	if replyToMessageID != 0 {
-		msg.ReplyToMessageID = replyToMessageID
+	if len(out.images) > 0 {
+		if err := sendPhotos(out); err != nil {
+			return err
+		}
+	} else if out.text.Len() > 0 || len(out.stickers)+len(out.voices) == 0 {
+		if err := sendText(out); err != nil {
+			return err
+		}
 	}
 
-	_, err := botInstance.Send(msg)
+	for _, stickerData := range out.stickers {
+		if err := sendSticker(out, stickerData); err != nil {
+			return err
+		}
+	}
+
+	for _, voiceData := range out.voices {
+		if err := sendVoice(out, voiceData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send sends a single Telegram message and keeps the result for ID mapping
+func (out *outgoingMessage) send(r *sendRequest) error {
+	message, err := outbound.send(out.chatID, r)
 	if err != nil {
-		logger.Error("Failed to send message to Telegram: %v", err)
 		return err
 	}
+	out.sent = append(out.sent, message)
+	return nil
+}
+
+// recordSentMessages maps the MaiBot message to the Telegram messages it was sent as
+// and reports the Telegram message ID back to MaiBot
+func recordSentMessages(messageBase *maibot.MessageBase, threadID int, sent []tgbotapi.Message) {
+	// Sent messages don't report their topic back through tgbotapi, but it is the one they were sent to
+	for _, message := range sent {
+		extras := messageExtras{MessageID: message.MessageID, MessageThreadID: threadID, IsTopicMessage: threadID != 0}
+		extras.Chat.ID = message.Chat.ID
+		extrasCache.remember(extras)
+	}
+
+	maibotID := messageBase.MessageInfo.MessageID
+	if maibotID == "" || len(sent) == 0 {
+		return
+	}
+
+	for _, message := range sent {
+		ref := message_store.TelegramRef{ChatID: message.Chat.ID, MessageID: message.MessageID}
+		if err := messageStore.Save(maibotID, ref); err != nil {
+			logger.Error("Failed to save message ID mapping: %v", err)
+		}
+	}
+
+	echo := &maibot.MessageBase{
+		MessageInfo:    messageBase.MessageInfo,
+		MessageSegment: maibot.NewEchoSegment(maibotID, strconv.Itoa(sent[0].MessageID)),
+	}
+	echo.MessageInfo.AdditionalConfig = map[string]interface{}{"echo": true}
+	SendToMaiBot(echo)
+}
+
+// resolveReplyID translates a MaiBot reply target to a Telegram message ID in the given chat.
+// The target is either the ID of a message MaiBot sent earlier or a Telegram message ID.
+func resolveReplyID(replyID string, chatID int64) (int, bool) {
+	if ref, ok := messageStore.GetTelegram(replyID); ok && ref.ChatID == chatID {
+		return ref.MessageID, true
+	}
+	id, err := strconv.Atoi(replyID)
+	return id, err == nil
+}
+
+// resolveThreadID picks the forum topic to send to when the group ID does not name one:
+// the message_thread_id MaiBot passed along, else the topic of the message replied to.
+// Messages that identify neither go to the General topic rather than to a guessed one.
+func resolveThreadID(messageBase *maibot.MessageBase, out *outgoingMessage) int {
+	switch threadID := messageBase.MessageInfo.AdditionalConfig["message_thread_id"].(type) {
+	case float64:
+		return int(threadID)
+	case int:
+		return threadID
+	case string:
+		if id, err := strconv.Atoi(threadID); err == nil {
+			return id
+		}
+	}
+
+	if out.replyToMessageID != 0 {
+		return threadOf(message_store.TelegramRef{ChatID: out.chatID, MessageID: out.replyToMessageID})
+	}
+	return 0
+}
+
+// takeReplyTo returns the message to reply to and clears it, so only the first sent message carries the reply
+func (out *outgoingMessage) takeReplyTo() int {
+	replyToMessageID := out.replyToMessageID
+	out.replyToMessageID = 0
+	return replyToMessageID
+}
+
+// sendText sends the collected text, split into several messages if it is too long
+func sendText(out *outgoingMessage) error {
+	// Handle empty message text
+	if out.text.Len() == 0 {
+		out.text.WriteString("[空消息]")
+	}
+
+	return sendTextChunks(out, splitText(out.text.String(), out.entities, maxMessageLength))
+}
+
+// sendTextChunks sends each chunk as a plain message; only the first one carries the reply
+func sendTextChunks(out *outgoingMessage, chunks []textChunk) error {
+	for _, chunk := range chunks {
+		msg := newTextRequest(out, chunk)
+		msg.setReplyTo(out.takeReplyTo())
+
+		if err := out.send(msg); err != nil {
+			logger.Error("Failed to send message to Telegram: %v", err)
+			return err
+		}
+	}
 
 	logger.Info("Message sent to Telegram successfully")
 	return nil
 }
 
+// sendPhotos sends the collected images, several of them as albums, using the text as the caption
+// of the first photo. Text that does not fit into the caption is sent as follow-up messages.
+func sendPhotos(out *outgoingMessage) error {
+	caption, rest := splitHead(out.text.String(), out.entities, maxCaptionLength)
+
+	if len(out.images) == 1 {
+		if err := sendPhotoList(out, out.images, caption); err != nil {
+			return err
+		}
+	} else {
+		// Spread the images evenly over the albums, since Telegram rejects albums of a single item
+		albums := (len(out.images) + maxMediaGroupSize - 1) / maxMediaGroupSize
+		size := (len(out.images) + albums - 1) / albums
+		for start := 0; start < len(out.images); start += size {
+			images := out.images[start:min(start+size, len(out.images))]
+			if err := sendAlbum(out, images, caption); err != nil {
+				logger.Warning("Failed to send album to Telegram, sending photos one by one: %v", err)
+				if err := sendPhotoList(out, images, caption); err != nil {
+					return err
+				}
+			}
+			// Only the first album carries the caption
+			caption = textChunk{}
+		}
+	}
+
+	logger.Info("Photo sent to Telegram successfully")
+	return sendTextChunks(out, splitText(rest.text, rest.entities, maxMessageLength))
+}
+
+// sendPhotoList sends images one by one, with the caption on the first photo
+func sendPhotoList(out *outgoingMessage, images [][]byte, caption textChunk) error {
+	for i, imageData := range images {
+		photo := newFileRequest("sendPhoto", "photo", "image.png", imageData, out)
+		if i == 0 {
+			photo.setText("caption", "caption_entities", caption)
+		}
+		photo.setReplyTo(out.takeReplyTo())
+
+		if err := out.send(photo); err != nil {
+			logger.Error("Failed to send photo to Telegram: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// sendAlbum sends up to maxMediaGroupSize images as one media group, with the caption on the first item.
+// The reply is only consumed when the album was sent, so a fallback can still use it.
+func sendAlbum(out *outgoingMessage, images [][]byte, caption textChunk) error {
+	album := newMediaGroupRequest(out, images, caption)
+	album.setReplyTo(out.replyToMessageID)
+
+	messages, err := outbound.sendMediaGroup(out.chatID, album)
+	if err != nil {
+		return err
+	}
+
+	out.takeReplyTo()
+	out.sent = append(out.sent, messages...)
+	return nil
+}
+
+// sendSticker converts the emoji image to WebP and sends it as a sticker, falling back to a photo
+func sendSticker(out *outgoingMessage, imageData []byte) error {
+	webpData, err := image.ToWebp(imageData)
+	if err != nil {
+		logger.Warning("Failed to convert emoji to WebP, sending as photo: %v", err)
+		photo := newFileRequest("sendPhoto", "photo", "emoji.png", imageData, out)
+		photo.setReplyTo(out.takeReplyTo())
+		if err := out.send(photo); err != nil {
+			logger.Error("Failed to send emoji photo to Telegram: %v", err)
+			return err
+		}
+		return nil
+	}
+
+	sticker := newFileRequest("sendSticker", "sticker", "sticker.webp", webpData, out)
+	sticker.setReplyTo(out.takeReplyTo())
+	if err := out.send(sticker); err != nil {
+		logger.Error("Failed to send sticker to Telegram: %v", err)
+		return err
+	}
+
+	logger.Info("Sticker sent to Telegram successfully")
+	return nil
+}
+
+// sendVoice transcodes the audio to OGG/Opus and sends it as a voice note
+func sendVoice(out *outgoingMessage, audioData []byte) error {
+	oggData, err := audio.ToOgg(audioData)
+	if err != nil {
+		logger.Error("Failed to convert voice to OGG: %v", err)
+		return err
+	}
+
+	voice := newFileRequest("sendVoice", "voice", "voice.ogg", oggData, out)
+	voice.params.AddNonZero("duration", audio.OggDuration(oggData))
+	voice.setReplyTo(out.takeReplyTo())
+	if err := out.send(voice); err != nil {
+		logger.Error("Failed to send voice to Telegram: %v", err)
+		return err
+	}
+
+	logger.Info("Voice sent to Telegram successfully")
+	return nil
+}
+
+// decodeEmojiImage returns the image bytes if the emoji segment carries base64 image data
+func decodeEmojiImage(emoji string) ([]byte, bool) {
+	data, err := base64.StdEncoding.DecodeString(emoji)
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, false
+	}
+	return data, true
+}
+
+// writeMention appends a mention of the user, as @username when known or as a text_mention entity otherwise
+func (out *outgoingMessage) writeMention(userID string) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		out.text.WriteString("@" + userID)
+		return
+	}
+
+	user, ok := users.get(id)
+	if ok && user.UserName != "" {
+		out.text.WriteString("@" + user.UserName)
+		return
+	}
+
+	name := "@" + userID
+	if ok {
+		name = user.FirstName
+		if user.LastName != "" {
+			name += " " + user.LastName
+		}
+	} else {
+		user = tgbotapi.User{ID: id}
+	}
+
+	out.entities = append(out.entities, tgbotapi.MessageEntity{
+		Type:   "text_mention",
+		Offset: utf16Len(out.text.String()),
+		Length: utf16Len(name),
+		User:   &user,
+	})
+	out.text.WriteString(name)
+}
+
 // processSegment processes a single message segment
-func processSegment(segment maibot.MessageSegment, messageText *strings.Builder, replyToMessageID *int) {
+func processSegment(segment maibot.MessageSegment, out *outgoingMessage) {
 	switch segment.Type {
 	case "text":
 		if text, ok := segment.Data.(string); ok {
-			messageText.WriteString(text)
+			out.text.WriteString(text)
 		}
 	case "reply":
 		if replyID, ok := segment.Data.(string); ok {
-			if id, err := strconv.Atoi(replyID); err == nil {
-				*replyToMessageID = id
+			if id, ok := resolveReplyID(replyID, out.chatID); ok {
+				out.replyToMessageID = id
 			}
 		}
 	case "at":
 		if userID, ok := segment.Data.(string); ok {
-			messageText.WriteString("@" + userID)
+			out.writeMention(userID)
 		}
 	case "emoji":
 		if emoji, ok := segment.Data.(string); ok {
-			messageText.WriteString(emoji)
+			if imageData, isImage := decodeEmojiImage(emoji); isImage {
+				out.stickers = append(out.stickers, imageData)
+			} else {
+				out.text.WriteString(emoji)
+			}
 		}
 	case "image":
-		messageText.WriteString("[图片]")
+		if base64Data, ok := segment.Data.(string); ok {
+			imageData, err := base64.StdEncoding.DecodeString(base64Data)
+			if err != nil {
+				logger.Error("Failed to decode image segment: %v", err)
+				out.text.WriteString("[图片]")
+				return
+			}
+			out.images = append(out.images, imageData)
+		}
+	case "voice":
+		if base64Data, ok := segment.Data.(string); ok {
+			voiceData, err := base64.StdEncoding.DecodeString(base64Data)
+			if err != nil {
+				logger.Error("Failed to decode voice segment: %v", err)
+				out.text.WriteString("[语音]")
+				return
+			}
+			out.voices = append(out.voices, voiceData)
+		}
 	default:
 		logger.Info("Unsupported segment type: %s", segment.Type)
 	}
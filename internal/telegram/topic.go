@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/message_store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// threadOf returns the forum topic a message was posted in, or 0 if it is not in one
+func threadOf(ref message_store.TelegramRef) int {
+	extras, _ := extrasCache.get(ref)
+	if !extras.IsTopicMessage {
+		return 0
+	}
+	return extras.MessageThreadID
+}
+
+// messageThread returns the forum topic of an inbound message, or 0 if it is not in one
+func messageThread(message *tgbotapi.Message) int {
+	return threadOf(message_store.TelegramRef{ChatID: message.Chat.ID, MessageID: message.MessageID})
+}
+
+// topicGroupID is the MaiBot group ID of a forum topic when topics are treated as separate groups
+func topicGroupID(chatID int64, threadID int) string {
+	return fmt.Sprintf("%d:%d", chatID, threadID)
+}
+
+// parseGroupID splits a MaiBot group ID into the Telegram chat and, for topicGroupID, the forum topic
+func parseGroupID(groupID string) (int64, int, error) {
+	chat, thread, found := strings.Cut(groupID, ":")
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil || !found {
+		return chatID, 0, err
+	}
+
+	threadID, err := strconv.Atoi(thread)
+	return chatID, threadID, err
+}
@@ -0,0 +1,157 @@
+package telegram
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// triggerResult tells how a message that passed MessageFilter is forwarded to MaiBot
+type triggerResult int
+
+const (
+	// triggerDrop means the message is not forwarded at all
+	triggerDrop triggerResult = iota
+	// triggerContext means the message is forwarded as context only, MaiBot should not respond to it
+	triggerContext
+	// triggerRespond means the message is forwarded for MaiBot to respond to
+	triggerRespond
+)
+
+// keywordPatterns caches the compiled Keywords of the trigger policies; invalid ones are stored as nil
+var keywordPatterns sync.Map
+
+// triggerPolicy returns the trigger policy of a chat
+func triggerPolicy(chatID int64) config.TriggerPolicy {
+	trigger := config.Get().Trigger
+	for _, chat := range trigger.Chats {
+		if chat.ChatID == chatID {
+			return chat.TriggerPolicy
+		}
+	}
+	return trigger.TriggerPolicy
+}
+
+// checkTrigger applies the trigger policy of the chat to a message, or to all items of an album.
+// Only groups have trigger policies; private chats and channels always trigger.
+func checkTrigger(messages ...tgbotapi.Message) triggerResult {
+	if len(messages) == 0 {
+		return triggerDrop
+	}
+
+	chat := messages[0].Chat
+	if !chat.IsGroup() && !chat.IsSuperGroup() {
+		return triggerRespond
+	}
+
+	policy := triggerPolicy(chat.ID)
+	if isTriggered(policy, messages) {
+		return triggerRespond
+	}
+	if policy.ForwardContext {
+		return triggerContext
+	}
+	return triggerDrop
+}
+
+// isTriggered reports whether messages should make MaiBot respond under policy
+func isTriggered(policy config.TriggerPolicy, messages []tgbotapi.Message) bool {
+	switch policy.Mode {
+	case "", "all":
+		return true
+	}
+
+	for i := range messages {
+		if addressesBot(&messages[i]) {
+			return true
+		}
+	}
+
+	switch policy.Mode {
+	case "mention":
+		return false
+	case "keyword":
+		for _, message := range messages {
+			if matchesKeyword(policy.Keywords, message.Text+"\n"+message.Caption) {
+				return true
+			}
+		}
+		return false
+	case "probability":
+		return rand.Float64() < policy.Probability
+	default:
+		logger.Warning("Unknown trigger mode %q, forwarding message", policy.Mode)
+		return true
+	}
+}
+
+// addressesBot reports whether a message @-mentions the bot, replies to it or is a command addressed to it
+func addressesBot(message *tgbotapi.Message) bool {
+	self := botInstance.Self
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == self.ID {
+		return true
+	}
+
+	for _, text := range []struct {
+		text     string
+		entities []tgbotapi.MessageEntity
+	}{{message.Text, message.Entities}, {message.Caption, message.CaptionEntities}} {
+		encoded := utf16.Encode([]rune(text.text))
+		for _, entity := range text.entities {
+			if entity.Offset < 0 || entity.Offset+entity.Length > len(encoded) {
+				continue
+			}
+			content := string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+
+			switch entity.Type {
+			case "mention":
+				if strings.EqualFold(content, "@"+self.UserName) {
+					return true
+				}
+			case "text_mention":
+				if entity.User != nil && entity.User.ID == self.ID {
+					return true
+				}
+			case "bot_command":
+				if strings.HasSuffix(strings.ToLower(content), "@"+strings.ToLower(self.UserName)) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesKeyword reports whether text matches one of the keyword regular expressions
+func matchesKeyword(keywords []string, text string) bool {
+	for _, keyword := range keywords {
+		pattern, ok := keywordPatterns.Load(keyword)
+		if !ok {
+			compiled, err := regexp.Compile(keyword)
+			if err != nil {
+				logger.Error("Invalid trigger keyword %q: %v", keyword, err)
+			}
+			pattern, _ = keywordPatterns.LoadOrStore(keyword, compiled)
+		}
+
+		if compiled := pattern.(*regexp.Regexp); compiled != nil && compiled.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTriggerConfig marks messages forwarded as context only, so MaiBot does not respond to them
+func addTriggerConfig(messageBase *maibot.MessageBase, trigger triggerResult) {
+	if trigger == triggerContext {
+		addAdditionalConfig(messageBase, map[string]interface{}{"context_only": true})
+	}
+}
@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// userCache remembers the Telegram users seen in inbound messages, so that
+// @username mentions can be resolved to numeric IDs and back
+type userCache struct {
+	mu         sync.RWMutex
+	byID       map[int64]tgbotapi.User
+	byUsername map[string]int64 // lower-cased username -> user ID
+}
+
+var users = newUserCache()
+
+func newUserCache() *userCache {
+	return &userCache{
+		byID:       make(map[int64]tgbotapi.User),
+		byUsername: make(map[string]int64),
+	}
+}
+
+// remember stores or refreshes a user
+func (c *userCache) remember(user *tgbotapi.User) {
+	if user == nil || user.ID == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop the stale username mapping if the user renamed themselves
+	if old, ok := c.byID[user.ID]; ok && old.UserName != "" && !strings.EqualFold(old.UserName, user.UserName) {
+		delete(c.byUsername, strings.ToLower(old.UserName))
+	}
+
+	c.byID[user.ID] = *user
+	if user.UserName != "" {
+		c.byUsername[strings.ToLower(user.UserName)] = user.ID
+	}
+}
+
+// rememberMessage stores every user referenced by a message
+func (c *userCache) rememberMessage(message *tgbotapi.Message) {
+	c.remember(message.From)
+	for i := range message.NewChatMembers {
+		c.remember(&message.NewChatMembers[i])
+	}
+	for _, entity := range message.Entities {
+		c.remember(entity.User)
+	}
+	for _, entity := range message.CaptionEntities {
+		c.remember(entity.User)
+	}
+	if message.ReplyToMessage != nil {
+		c.remember(message.ReplyToMessage.From)
+	}
+}
+
+// lookupUsername resolves a username (with or without the leading @) to a user ID
+func (c *userCache) lookupUsername(username string) (int64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	id, ok := c.byUsername[strings.ToLower(strings.TrimPrefix(username, "@"))]
+	return id, ok
+}
+
+// get returns the cached user with the given ID
+func (c *userCache) get(id int64) (tgbotapi.User, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	user, ok := c.byID[id]
+	return user, ok
+}
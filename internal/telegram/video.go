@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/maibot"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/media/video"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// videoClip is what GIFs, videos and video notes have in common
+type videoClip struct {
+	kind      string // shown to MaiBot, e.g. "动图"
+	file      *remoteFile
+	duration  int
+	fileSize  int
+	thumbnail *tgbotapi.PhotoSize
+}
+
+// convertVideo describes a clip and forwards a few of its frames as images, so MaiBot
+// can see what was shared. Large clips, or Video.Frames <= 1, only use Telegram's thumbnail.
+func convertVideo(clip videoClip) []maibot.MessageSegment {
+	segments := []maibot.MessageSegment{
+		maibot.NewTextSegment(fmt.Sprintf("[%s] 时长 %d 秒", clip.kind, clip.duration)),
+	}
+
+	videoConfig := config.Get().Video
+	if videoConfig.Frames > 1 && clip.fileSize <= videoConfig.MaxSize {
+		frames, err := extractFrames(clip.file, clip.duration, videoConfig.Frames)
+		if err == nil {
+			for _, frame := range frames {
+				segments = append(segments, maibot.NewImageSegment(base64.StdEncoding.EncodeToString(frame)))
+			}
+			return segments
+		}
+		logger.Error("Failed to extract %s frames, using thumbnail: %v", clip.kind, err)
+	}
+
+	if clip.thumbnail != nil {
+		thumbnail, err := GetFileContent(clip.thumbnail.FileID, botInstance)
+		if err != nil {
+			logger.Error("Failed to get %s thumbnail: %v", clip.kind, err)
+			return segments
+		}
+		segments = append(segments, maibot.NewImageSegment(base64.StdEncoding.EncodeToString(thumbnail)))
+	}
+
+	return segments
+}
+
+// extractFrames downloads a clip and extracts count frames spread over it
+func extractFrames(file *remoteFile, duration, count int) ([][]byte, error) {
+	fileContent, err := file.get()
+	if err != nil {
+		return nil, err
+	}
+	return video.Frames(fileContent, duration, count)
+}
@@ -0,0 +1,153 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/config"
+	"github.com/MaiM-with-u/maibot-telegram-adapter/internal/logger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretTokenHeader carries the secret_token passed to setWebhook on every webhook request
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// startPolling removes any webhook left over from webhook mode and starts long polling
+func startPolling(bot *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, error) {
+	// getUpdates is refused while a webhook is set
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, err
+	}
+
+	// Create a new UpdateConfig struct with an offset of 0. Offsets are used
+	// to make sure Telegram knows we've handled previous values and we don't
+	// need them repeated.
+	updateConfig := tgbotapi.NewUpdate(0)
+
+	// Tell Telegram we should wait up to 30 seconds on each request for an
+	// update. This way we can get information just as quickly as making many
+	// frequent requests without having to send nearly as many.
+	updateConfig.Timeout = 30
+
+	// Poll Telegram for updates. tgbotapi's GetUpdatesChan is not used since it
+	// decodes updates itself, and decodeUpdate needs the raw JSON.
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+	go func() {
+		for {
+			resp, err := bot.Request(updateConfig)
+			var rawUpdates []json.RawMessage
+			if err == nil {
+				err = json.Unmarshal(resp.Result, &rawUpdates)
+			}
+			if err != nil {
+				logger.Error("Failed to get updates, retrying in 3 seconds: %v", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+
+			for _, raw := range rawUpdates {
+				// Confirm every update, even one that can't be parsed, or getUpdates returns it forever
+				var header struct {
+					UpdateID int `json:"update_id"`
+				}
+				if err := json.Unmarshal(raw, &header); err != nil || header.UpdateID < updateConfig.Offset {
+					continue
+				}
+				updateConfig.Offset = header.UpdateID + 1
+
+				update, err := decodeUpdate(raw)
+				if err != nil {
+					logger.Error("Failed to parse update %d: %v", header.UpdateID, err)
+					continue
+				}
+				updates <- update
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+// startWebhook registers the webhook with Telegram and serves it, feeding received updates into the returned channel
+func startWebhook(bot *tgbotapi.BotAPI, cfg config.TelegramConfig) (tgbotapi.UpdatesChannel, error) {
+	webhookURL, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a secret token anyone could post fake updates, so make one up if none is configured.
+	// It only has to last as long as the process, since setWebhook is called on every start.
+	if cfg.SecretToken == "" {
+		if cfg.SecretToken, err = generateSecretToken(); err != nil {
+			return nil, err
+		}
+		logger.Info("No webhook SecretToken configured, using a random one")
+	}
+
+	// WebhookConfig of tgbotapi v5.5.1 has no secret_token field, so set the webhook with raw params
+	params := tgbotapi.Params{"url": webhookURL.String(), "secret_token": cfg.SecretToken}
+	if _, err := bot.MakeRequest("setWebhook", params); err != nil {
+		return nil, err
+	}
+
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+
+	path := webhookURL.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.SecretToken)) != 1 {
+			logger.Warning("Rejected webhook request with invalid secret token from %s", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("Failed to read webhook update: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Updates that can't be parsed are acknowledged anyway, since Telegram would redeliver them forever
+		update, err := decodeUpdate(body)
+		if err != nil {
+			logger.Error("Failed to parse webhook update: %v", err)
+			return
+		}
+
+		updates <- update
+	})
+
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: mux}
+	go func() {
+		logger.Info("Listening for webhook updates on %s%s", cfg.ListenAddr, path)
+		var err error
+		if cfg.CertFile != "" {
+			err = server.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		logger.Fatal("Webhook server stopped: %v", err)
+	}()
+
+	return updates, nil
+}
+
+// generateSecretToken returns a random token made of characters setWebhook accepts as secret_token
+func generateSecretToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}